@@ -0,0 +1,228 @@
+package pmmap
+
+import "slices"
+
+// Builder is a transient (mutable) version of a [Tree] that is used to
+// construct maps efficiently.
+//
+// Nodes allocated by the builder are updated in-place, whereas nodes that are
+// shared with other maps are copied before they are updated. Persistent maps
+// are produced from the builder with Freeze.
+//
+// A Builder is not safe for concurrent use.
+type Builder[K, V any] struct {
+	hasher Hasher[K]
+	root   node[K, V]
+	edit   *editToken
+}
+
+// editToken identifies the nodes that a Builder may mutate in-place.
+// The type has non-zero size such that distinct tokens have distinct addresses.
+type editToken struct{ _ byte }
+
+// NewBuilder constructs an empty map builder with the specified hasher.
+func NewBuilder[V, K any](hasher Hasher[K]) *Builder[K, V] {
+	return New[V](hasher).ToBuilder()
+}
+
+// ToBuilder returns a builder that starts out with the contents of the map.
+// The map itself is not affected by updates to the builder.
+func (tree Tree[K, V]) ToBuilder() *Builder[K, V] {
+	return &Builder[K, V]{tree.hasher, tree.root, new(editToken)}
+}
+
+func (b *Builder[K, V]) tree() Tree[K, V] {
+	return Tree[K, V]{b.hasher, b.root}
+}
+
+// Lookup returns the value mapped to the provided key in the builder.
+func (b *Builder[K, V]) Lookup(key K) (V, bool) {
+	return b.tree().Lookup(key)
+}
+
+// Size returns the number of key-value pairs in the builder.
+func (b *Builder[K, V]) Size() int {
+	return nodeSize(b.root)
+}
+
+// Insert the given key-value pair into the builder.
+// Replaces previous value with the same key if it exists.
+func (b *Builder[K, V]) Insert(key K, value V) {
+	b.InsertOrMerge(key, value, nil)
+}
+
+// Inserts the given key-value pair into the builder. If a previous mapping
+// (prevValue) exists for the key, the inserted value will be `f(value, prevValue)`.
+func (b *Builder[K, V]) InsertOrMerge(key K, value V, f MergeFunc[V]) {
+	b.root, _ = insertT(b.root, b.tree().hash(key), key, value, b.hasher, f, b.edit)
+}
+
+// Remove a mapping for the given key if it exists.
+func (b *Builder[K, V]) Remove(key K) {
+	b.root, _ = removeT(b.root, b.tree().hash(key), key, b.hasher, b.edit)
+}
+
+// Merge the contents of the other map into the builder.
+// See [Tree.Merge] for details.
+func (b *Builder[K, V]) Merge(other Tree[K, V], f MergeFunc[V]) {
+	b.root, _ = merge(b.root, other.root, b.hasher, f)
+}
+
+// Freeze returns a persistent map with the contents of the builder.
+//
+// The builder can still be used afterwards, but subsequent updates will not
+// affect the returned map.
+func (b *Builder[K, V]) Freeze() Tree[K, V] {
+	// Relinquish ownership of all nodes reachable from the returned map
+	b.edit = new(editToken)
+	return b.tree()
+}
+
+// editable returns the leaf if it is owned by edit, and otherwise a copy of
+// the leaf that is.
+func (l *leaf[K, V]) editable(edit *editToken) *leaf[K, V] {
+	if l.edit == edit {
+		return l
+	}
+
+	lf := l.copy()
+	lf.edit = edit
+	return lf
+}
+
+// editable returns the branch if it is owned by edit, and otherwise a copy of
+// the branch that is.
+func (b *branch[K, V]) editable(edit *editToken) *branch[K, V] {
+	if b.edit == edit {
+		return b
+	}
+
+	return &branch[K, V]{
+		prefix:    b.prefix,
+		branchBit: b.branchBit,
+		left:      b.left,
+		right:     b.right,
+		size:      b.size,
+		edit:      edit,
+	}
+}
+
+// insertT is the transient version of insert. Nodes owned by edit are updated
+// in-place, so the returned flag must be used to detect changes.
+func insertT[K, V any](tree node[K, V], hash keyt, key K, value V, hasher Hasher[K], f MergeFunc[V], edit *editToken) (node[K, V], bool) {
+	if tree == nil {
+		return &leaf[K, V]{key: hash, values: []pair[K, V]{{key, value}}, edit: edit}, true
+	}
+
+	var prefix keyt
+	switch tree := tree.(type) {
+	case *leaf[K, V]:
+		if tree.key == hash {
+			for i, pr := range tree.values {
+				// If key matches previous key, replace value
+				if hasher.Equal(key, pr.key) {
+					newValue := value
+					if f != nil {
+						var equal bool
+						newValue, equal = f(value, pr.value)
+
+						if equal {
+							return tree, false
+						}
+					}
+
+					lf := tree.editable(edit)
+					lf.values[i].value = newValue
+					return lf, true
+				}
+			}
+
+			// Hash collision - add to list of values in leaf
+			lf := tree.editable(edit)
+			lf.values = slices.Insert(lf.values, bucketIndex(lf.values, key, hasher), pair[K, V]{key, value})
+			return lf, true
+		}
+
+		prefix = tree.key
+
+	case *branch[K, V]:
+		if tree.match(hash) {
+			l, r := tree.left, tree.right
+			var changed bool
+			if zeroBit(hash, tree.branchBit) {
+				l, changed = insertT(l, hash, key, value, hasher, f, edit)
+			} else {
+				r, changed = insertT(r, hash, key, value, hasher, f, edit)
+			}
+			if !changed {
+				return tree, false
+			}
+
+			br := tree.editable(edit)
+			br.left, br.right, br.size = l, r, nodeSize(l)+nodeSize(r)
+			return br, true
+		}
+
+		prefix = tree.prefix
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	newLeaf, _ := insertT(nil, hash, key, value, nil, nil, edit)
+	br := join(hash, prefix, newLeaf, tree)
+	br.edit = edit
+	return br, true
+}
+
+// removeT is the transient version of remove. Nodes owned by edit are updated
+// in-place, so the returned flag must be used to detect changes.
+func removeT[K, V any](tree node[K, V], hash keyt, key K, hasher Hasher[K], edit *editToken) (node[K, V], bool) {
+	switch tree := tree.(type) {
+	case nil:
+		return nil, false
+
+	case *leaf[K, V]:
+		if tree.key == hash {
+			for i, pr := range tree.values {
+				if hasher.Equal(key, pr.key) {
+					if len(tree.values) == 1 { // Common case
+						return nil, true
+					}
+
+					lf := tree.editable(edit)
+					lf.values = slices.Delete(lf.values, i, i+1)
+					return lf, true
+				}
+			}
+		}
+
+	case *branch[K, V]:
+		if tree.match(hash) {
+			l, r := tree.left, tree.right
+			var changed bool
+			if zeroBit(hash, tree.branchBit) {
+				l, changed = removeT(l, hash, key, hasher, edit)
+			} else {
+				r, changed = removeT(r, hash, key, hasher, edit)
+			}
+
+			if !changed {
+				return tree, false
+			} else if l == nil {
+				return r, true
+			} else if r == nil {
+				return l, true
+			}
+
+			br := tree.editable(edit)
+			br.left, br.right, br.size = l, r, nodeSize(l)+nodeSize(r)
+			return br, true
+		}
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	return tree, false
+}
@@ -0,0 +1,88 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	hit, miss := mkTest[int, int](t)
+	N := 100
+
+	for range 20 {
+		for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+			b := NewBuilder[int](hasher)
+			expect := make(map[int]int)
+			for range 2 * N {
+				k := rand.Intn(N)
+				if rand.Intn(4) == 0 {
+					b.Remove(k)
+					delete(expect, k)
+				} else {
+					b.Insert(k, k+1)
+					expect[k] = k + 1
+				}
+			}
+
+			if sz := b.Size(); sz != len(expect) {
+				t.Fatalf("Expected size %d, got %d", len(expect), sz)
+			}
+
+			tree := b.Freeze()
+			reconstructed := New[int](hasher)
+			for k, v := range expect {
+				reconstructed = reconstructed.Insert(k, v)
+			}
+			if !tree.Equal(reconstructed, cmpEq[int]) {
+				t.Fatal("Expected", tree, "to equal", reconstructed)
+			}
+
+			// Updates after freezing must not affect the frozen map
+			for k := range N {
+				b.Insert(k, -k)
+			}
+			b.Remove(0)
+			for k := range N {
+				if v, ok := expect[k]; ok {
+					hit(tree, k, v)
+				} else {
+					miss(tree, k)
+				}
+			}
+		}
+	}
+
+	t.Run("ToBuilder", func(t *testing.T) {
+		tree := New[int](intHasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		b := tree.ToBuilder()
+		for i := range N / 2 {
+			b.Remove(i)
+			b.Insert(N+i, i)
+		}
+		b.Merge(New[int](intHasher).Insert(-1, -1), max)
+
+		// The source map is unaffected
+		for i := range N {
+			hit(tree, i, i)
+		}
+		miss(tree, N)
+		if sz := tree.Size(); sz != N {
+			t.Errorf("Expected size %d, got %d", N, sz)
+		}
+
+		res := b.Freeze()
+		for i := range N / 2 {
+			miss(res, i)
+			hit(res, N/2+i, N/2+i)
+			hit(res, N+i, i)
+		}
+		hit(res, -1, -1)
+		if sz := res.Size(); sz != N+1 {
+			t.Errorf("Expected size %d, got %d", N+1, sz)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package pmmap
+
+import (
+	"cmp"
+	"iter"
+	"math/bits"
+	"slices"
+)
+
+// Collect constructs a map from the key-value pairs in seq.
+//
+// If a key occurs more than once, the values are combined as if the pairs were
+// inserted in order with [Tree.InsertOrMerge]. If `f` is nil, later values
+// replace earlier ones.
+//
+// Every key is hashed exactly once. The pairs are sorted by hash and the map is
+// constructed bottom-up, which is considerably faster than repeated insertion.
+func Collect[K, V any](hasher Hasher[K], seq iter.Seq2[K, V], f MergeFunc[V]) Tree[K, V] {
+	var entries []collectEntry[K, V]
+	for k, v := range seq {
+		entries = append(entries, collectEntry[K, V]{hasher.Hash(k), pair[K, V]{k, v}})
+	}
+
+	// The patricia trie is ordered by the reversed hash keys, which is the
+	// same as ordering by the original hash values.
+	slices.SortStableFunc(entries, func(a, b collectEntry[K, V]) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+
+	return Tree[K, V]{hasher, build(entries, hasher, f)}
+}
+
+// CollectSet constructs a set from the keys in seq.
+// See [Collect] for details.
+func CollectSet[K any](hasher Hasher[K], seq iter.Seq[K]) Set[K] {
+	return Set[K]{Collect(hasher, func(yield func(K, struct{}) bool) {
+		for k := range seq {
+			if !yield(k, struct{}{}) {
+				return
+			}
+		}
+	}, nil)}
+}
+
+// collectEntry is a key-value pair with its (non-reversed) hash.
+type collectEntry[K, V any] struct {
+	hash uint64
+	pair[K, V]
+}
+
+// build constructs a patricia trie from entries sorted by hash, in linear time.
+func build[K, V any](entries []collectEntry[K, V], hasher Hasher[K], f MergeFunc[V]) node[K, V] {
+	// The trie is constructed like a Cartesian tree over the branching bits
+	// between consecutive leaves. The stack contains the right spine of the
+	// trie, where each entry is separated from the entry below it by bit.
+	type spine struct {
+		n   node[K, V]
+		key keyt // The hash key of the left-most leaf in n
+		bit keyt
+	}
+	var stack []spine
+
+	// Pop the top of the stack and make it the right subtree of the entry below it.
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		below := &stack[len(stack)-1]
+		below.n = newBranch(below.key&(top.bit-1), top.bit, below.n, top.n)
+	}
+
+	for len(entries) > 0 {
+		// Gather entries with equal hashes into a single leaf
+		hash := entries[0].hash
+		lf := &leaf[K, V]{key: bits.Reverse64(hash)}
+	ENTRIES:
+		for ; len(entries) > 0 && entries[0].hash == hash; entries = entries[1:] {
+			pr := entries[0].pair
+			for i, prev := range lf.values {
+				if hasher.Equal(pr.key, prev.key) {
+					if f != nil {
+						pr.value, _ = f(pr.value, prev.value)
+					}
+					lf.values[i].value = pr.value
+					continue ENTRIES
+				}
+			}
+
+			lf.values = slices.Insert(lf.values, bucketIndex(lf.values, pr.key, hasher), pr)
+		}
+
+		if len(stack) == 0 {
+			stack = append(stack, spine{lf, lf.key, 0})
+			continue
+		}
+
+		bit := branchingBit(stack[len(stack)-1].key, lf.key)
+		for len(stack) > 1 && stack[len(stack)-1].bit > bit {
+			pop()
+		}
+		stack = append(stack, spine{lf, lf.key, bit})
+	}
+
+	if len(stack) == 0 {
+		return nil
+	}
+
+	for len(stack) > 1 {
+		pop()
+	}
+	return stack[0].n
+}
@@ -0,0 +1,63 @@
+package pmmap
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	N := 100
+
+	for range 50 {
+		for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+			var keys, values []int
+			for range 2 * N {
+				keys = append(keys, rand.Intn(N))
+				values = append(values, rand.Int())
+			}
+
+			expect := New[int](hasher)
+			for i, k := range keys {
+				expect = expect.InsertOrMerge(k, values[i], max)
+			}
+
+			tree := Collect(hasher, func(yield func(int, int) bool) {
+				for i, k := range keys {
+					if !yield(k, values[i]) {
+						return
+					}
+				}
+			}, max)
+
+			if !tree.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", tree, "to equal", expect)
+			}
+			if sz := tree.Size(); sz != expect.Size() {
+				t.Fatalf("Expected size %d, got %d", expect.Size(), sz)
+			}
+
+			set := CollectSet(hasher, slices.Values(keys))
+			if !set.Equal(expect.KeySet()) {
+				t.Fatal("Expected", set, "to equal", expect.KeySet())
+			}
+		}
+	}
+
+	t.Run("LastWins", func(t *testing.T) {
+		tree := Collect(intHasher, func(yield func(int, int) bool) {
+			_ = yield(1, 1) && yield(2, 2) && yield(1, 3)
+		}, nil)
+
+		hit, _ := mkTest[int, int](t)
+		hit(tree, 1, 3)
+		hit(tree, 2, 2)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if tree := Collect(intHasher, maps.All(map[int]int{}), nil); tree.root != nil {
+			t.Errorf("Expected empty tree, got %v", tree)
+		}
+	})
+}
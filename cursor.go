@@ -0,0 +1,150 @@
+package pmmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// Cursor is a resumable iterator over the key-value pairs in a map.
+//
+// Pairs are visited in the same order as [Tree.All], which is ascending order
+// of key hashes. Since maps are immutable, a cursor remains valid regardless of
+// updates to other versions of the map.
+//
+// A Cursor is not safe for concurrent use.
+type Cursor[K, V any] struct {
+	tree Tree[K, V]
+	// Subtrees that remain to be visited, with the next one on top.
+	stack []node[K, V]
+	// The leaf currently being visited and the position in its bucket.
+	leaf *leaf[K, V]
+	idx  int
+}
+
+// ErrInvalidPosition is returned when a cursor position cannot be decoded.
+var ErrInvalidPosition = errors.New("pmmap: invalid cursor position")
+
+// Cursor returns a cursor that is positioned at the beginning of the map.
+func (tree Tree[K, V]) Cursor() *Cursor[K, V] {
+	c := &Cursor[K, V]{tree: tree}
+	c.Reset()
+	return c
+}
+
+// Reset positions the cursor at the beginning of the map.
+func (c *Cursor[K, V]) Reset() {
+	c.stack, c.leaf, c.idx = c.stack[:0], nil, 0
+	if c.tree.root != nil {
+		c.stack = append(c.stack, c.tree.root)
+	}
+}
+
+// fill ensures that c.leaf points to the leaf containing the next key-value
+// pair, returning false if there are no more pairs.
+func (c *Cursor[K, V]) fill() bool {
+	for c.leaf == nil || c.idx >= len(c.leaf.values) {
+		if len(c.stack) == 0 {
+			c.leaf = nil
+			return false
+		}
+
+		n := c.stack[len(c.stack)-1]
+		c.stack = c.stack[:len(c.stack)-1]
+		for {
+			if b, ok := n.(*branch[K, V]); ok {
+				c.stack = append(c.stack, b.right)
+				n = b.left
+			} else {
+				c.leaf, c.idx = n.(*leaf[K, V]), 0
+				break
+			}
+		}
+	}
+	return true
+}
+
+// Next returns the next key-value pair and advances the cursor.
+// The last result is false if there are no more pairs.
+func (c *Cursor[K, V]) Next() (key K, value V, ok bool) {
+	if !c.fill() {
+		return
+	}
+
+	pr := c.leaf.values[c.idx]
+	c.idx++
+	return pr.key, pr.value, true
+}
+
+// Seek positions the cursor at the first key-value pair whose key has a hash
+// (as computed by the map's hasher) greater than or equal to the given hash.
+func (c *Cursor[K, V]) Seek(hash uint64) {
+	c.stack, c.leaf, c.idx = c.stack[:0], nil, 0
+	target := bits.Reverse64(hash)
+
+	n := c.tree.root
+	for n != nil {
+		switch nd := n.(type) {
+		case *leaf[K, V]:
+			if bits.Reverse64(nd.key) >= hash {
+				c.stack = append(c.stack, nd)
+			}
+			return
+
+		case *branch[K, V]:
+			if !nd.match(target) {
+				// All keys in the subtree are on the same side of the target.
+				// The lowest bit where they differ determines which side.
+				if zeroBit(target, branchingBit(target, nd.prefix)) {
+					c.stack = append(c.stack, nd)
+				}
+				return
+			}
+
+			if zeroBit(target, nd.branchBit) {
+				c.stack = append(c.stack, nd.right)
+				n = nd.left
+			} else {
+				n = nd.right
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+	}
+}
+
+// Position returns an opaque encoding of the position of the cursor.
+// The position can be restored with SetPosition on any cursor over the same
+// map, for instance to resume a paginated traversal.
+func (c *Cursor[K, V]) Position() []byte {
+	if !c.fill() {
+		return []byte{0}
+	}
+
+	buf := append([]byte{1}, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(buf[1:], bits.Reverse64(c.leaf.key))
+	return binary.AppendUvarint(buf, uint64(c.idx))
+}
+
+// SetPosition restores a position that was returned by Position.
+func (c *Cursor[K, V]) SetPosition(pos []byte) error {
+	if len(pos) == 1 && pos[0] == 0 {
+		c.stack, c.leaf, c.idx = c.stack[:0], nil, 0
+		return nil
+	} else if len(pos) < 10 || pos[0] != 1 {
+		return ErrInvalidPosition
+	}
+
+	hash := binary.BigEndian.Uint64(pos[1:])
+	idx, n := binary.Uvarint(pos[9:])
+	if n <= 0 || 9+n != len(pos) {
+		return ErrInvalidPosition
+	}
+
+	c.Seek(hash)
+	if c.fill() && c.leaf.key == bits.Reverse64(hash) {
+		c.idx = int(min(idx, uint64(len(c.leaf.values))))
+	}
+	return nil
+}
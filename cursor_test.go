@@ -0,0 +1,105 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		tree := New[int](hasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		var expect []int
+		for k := range tree.Keys() {
+			expect = append(expect, k)
+		}
+
+		t.Run("Next", func(t *testing.T) {
+			c := tree.Cursor()
+			for i := range expect {
+				k, v, ok := c.Next()
+				if !ok || k != expect[i] || v != k {
+					t.Fatalf("Next() = %d, %d, %v, expected %d", k, v, ok, expect[i])
+				}
+			}
+			if _, _, ok := c.Next(); ok {
+				t.Fatal("Expected cursor to be exhausted")
+			}
+		})
+
+		t.Run("Pagination", func(t *testing.T) {
+			var got []int
+			pos := tree.Cursor().Position()
+			for {
+				// Resume from the serialized position with a fresh cursor
+				c := tree.Cursor()
+				if err := c.SetPosition(pos); err != nil {
+					t.Fatal(err)
+				}
+
+				var ok bool
+				for range 7 {
+					var k int
+					if k, _, ok = c.Next(); !ok {
+						break
+					}
+					got = append(got, k)
+				}
+				if !ok {
+					break
+				}
+				pos = c.Position()
+			}
+
+			if len(got) != len(expect) {
+				t.Fatalf("Expected %d keys, got %d", len(expect), len(got))
+			}
+			for i := range got {
+				if got[i] != expect[i] {
+					t.Fatalf("Expected %v, got %v", expect, got)
+				}
+			}
+		})
+	}
+
+	t.Run("Seek", func(t *testing.T) {
+		tree := New[int](intHasher)
+		keys := make(map[int]bool)
+		for range N {
+			k := rand.Intn(10 * N)
+			keys[k] = true
+			tree = tree.Insert(k, k)
+		}
+
+		c := tree.Cursor()
+		for range N {
+			h := rand.Intn(11 * N)
+			expect := -1
+			for k := h; k < 10*N; k++ {
+				if keys[k] {
+					expect = k
+					break
+				}
+			}
+
+			c.Seek(uint64(h))
+			if k, _, ok := c.Next(); expect == -1 && ok || expect != -1 && k != expect {
+				t.Fatalf("After Seek(%d), Next() = %d, %v, expected %d", h, k, ok, expect)
+			}
+		}
+	})
+
+	t.Run("InvalidPosition", func(t *testing.T) {
+		c := New[int](intHasher).Cursor()
+		for _, pos := range [][]byte{nil, {2}, {1, 0, 0}} {
+			if err := c.SetPosition(pos); err != ErrInvalidPosition {
+				t.Errorf("SetPosition(%v) = %v", pos, err)
+			}
+		}
+	})
+}
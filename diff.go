@@ -0,0 +1,146 @@
+package pmmap
+
+import "iter"
+
+// ChangeKind describes how a key differs between two maps.
+type ChangeKind uint8
+
+const (
+	// Added means the key is only present in the new map.
+	Added ChangeKind = iota
+	// Removed means the key is only present in the old map.
+	Removed
+	// Changed means the key is present in both maps with different values.
+	Changed
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes a difference between two maps for a single key.
+// Old is the zero value for added keys and New is the zero value for removed
+// keys.
+type Change[K, V any] struct {
+	Kind     ChangeKind
+	Key      K
+	Old, New V
+}
+
+// Diff returns an iterator over the differences between this map (the old
+// version) and the other map (the new version). Values are compared with the
+// provided function.
+//
+// The differences are computed lazily while iterating, and shared subtrees
+// are skipped. Diffing a map with a version of the map with r updates takes
+// linear time in r.
+func (tree Tree[K, V]) Diff(other Tree[K, V], eq func(V, V) bool) iter.Seq[Change[K, V]] {
+	return func(yield func(Change[K, V]) bool) {
+		diff(tree.root, other.root, tree.hasher, eq, yield)
+	}
+}
+
+// diffAll yields a change of the given kind for every key-value pair in n.
+func diffAll[K, V any](n node[K, V], kind ChangeKind, yield func(Change[K, V]) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	return n.iter(func(k K, v V) bool {
+		ch := Change[K, V]{Kind: kind, Key: k}
+		if kind == Added {
+			ch.New = v
+		} else {
+			ch.Old = v
+		}
+		return yield(ch)
+	})
+}
+
+// diff yields the changes from a to b, returning false if iteration was
+// stopped early.
+func diff[K, V any](a, b node[K, V], hasher Hasher[K], eq func(V, V) bool, yield func(Change[K, V]) bool) bool {
+	if a == b {
+		return true
+	} else if a == nil {
+		return diffAll(b, Added, yield)
+	} else if b == nil {
+		return diffAll(a, Removed, yield)
+	}
+
+	if lf, ok := a.(*leaf[K, V]); ok {
+		for _, pr := range lf.values {
+			if bv, found := lookup(b, lf.key, pr.key, hasher); !found {
+				if !yield(Change[K, V]{Kind: Removed, Key: pr.key, Old: pr.value}) {
+					return false
+				}
+			} else if !eq(pr.value, bv) {
+				if !yield(Change[K, V]{Changed, pr.key, pr.value, bv}) {
+					return false
+				}
+			}
+		}
+
+		return b.iter(func(k K, v V) bool {
+			if _, found := lookup(a, lf.key, k, hasher); found {
+				return true
+			}
+			return yield(Change[K, V]{Kind: Added, Key: k, New: v})
+		})
+	} else if lf, ok := b.(*leaf[K, V]); ok {
+		if !a.iter(func(k K, v V) bool {
+			if bv, found := lookup(b, lf.key, k, hasher); !found {
+				return yield(Change[K, V]{Kind: Removed, Key: k, Old: v})
+			} else if !eq(v, bv) {
+				return yield(Change[K, V]{Changed, k, v, bv})
+			}
+			return true
+		}) {
+			return false
+		}
+
+		for _, pr := range lf.values {
+			if _, found := lookup(a, lf.key, pr.key, hasher); !found {
+				if !yield(Change[K, V]{Kind: Added, Key: pr.key, New: pr.value}) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// Both a and b are branches
+	s, t := a.(*branch[K, V]), b.(*branch[K, V])
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		return diff(s.left, t.left, hasher, eq, yield) &&
+			diff(s.right, t.right, hasher, eq, yield)
+	} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		if zeroBit(t.prefix, s.branchBit) {
+			return diff(s.left, t, hasher, eq, yield) &&
+				diffAll(s.right, Removed, yield)
+		}
+		return diffAll(s.left, Removed, yield) &&
+			diff(s.right, t, hasher, eq, yield)
+	} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+		// t contains s
+		if zeroBit(s.prefix, t.branchBit) {
+			return diff(s, t.left, hasher, eq, yield) &&
+				diffAll(t.right, Added, yield)
+		}
+		return diffAll(t.left, Added, yield) &&
+			diff(s, t.right, hasher, eq, yield)
+	}
+
+	// prefixes disagree
+	return diffAll(s, Removed, yield) && diffAll(t, Added, yield)
+}
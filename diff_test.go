@@ -0,0 +1,94 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	N := 100
+
+	for range 50 {
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			a, b := New[int](hasher), New[int](hasher)
+			expect := make(map[int]Change[int, int])
+			for i := range 2 * N {
+				switch rand.Intn(4) {
+				case 0:
+					a = a.Insert(i, i)
+					expect[i] = Change[int, int]{Kind: Removed, Key: i, Old: i}
+				case 1:
+					b = b.Insert(i, i)
+					expect[i] = Change[int, int]{Kind: Added, Key: i, New: i}
+				case 2:
+					a, b = a.Insert(i, i), b.Insert(i, -i)
+					if i != 0 {
+						expect[i] = Change[int, int]{Changed, i, i, -i}
+					}
+				default:
+					a, b = a.Insert(i, i), b.Insert(i, i)
+				}
+			}
+
+			seen := make(map[int]bool)
+			for ch := range a.Diff(b, cmpEq[int]) {
+				if seen[ch.Key] {
+					t.Fatalf("Diff yielded %d twice", ch.Key)
+				}
+				seen[ch.Key] = true
+
+				if ex, ok := expect[ch.Key]; !ok || ex != ch {
+					t.Fatalf("Diff yielded %v, expected %v", ch, ex)
+				}
+			}
+
+			if len(seen) != len(expect) {
+				t.Fatalf("Diff yielded %d changes, expected %d", len(seen), len(expect))
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+		b := a.Insert(N, N).Remove(0).Insert(1, -1)
+
+		calls := 0
+		eq := func(x, y int) bool {
+			calls++
+			return x == y
+		}
+
+		var changes []Change[int, int]
+		for ch := range a.Diff(b, eq) {
+			changes = append(changes, ch)
+		}
+
+		if len(changes) != 3 {
+			t.Errorf("Expected 3 changes, got %v", changes)
+		}
+		if calls > 1 {
+			t.Errorf("Expected shared subtrees to be skipped, eq was called %d times", calls)
+		}
+	})
+
+	t.Run("EarlyTermination", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+
+		count := 0
+		for range a.Diff(New[int](intHasher), cmpEq[int]) {
+			count++
+			if count == 3 {
+				break
+			}
+		}
+		if count != 3 {
+			t.Fatalf("expected 3 iterations, got %d", count)
+		}
+	})
+}
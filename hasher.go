@@ -1,6 +1,7 @@
 package pmmap
 
 import (
+	"cmp"
 	"hash/maphash"
 	"math/bits"
 	"unsafe"
@@ -16,6 +17,19 @@ type Hasher[K any] interface {
 	Hash(K) uint64
 }
 
+// CanonicalHasher is an optional extension of Hasher for key types with a
+// total order that is consistent with Equal.
+//
+// Keys with colliding hashes are kept sorted by Compare, which makes the
+// iteration order of a map depend only on its contents: maps that are equal
+// iterate in the same order regardless of how they were constructed.
+// For other hashers the order of colliding keys depends on the order in which
+// they were added.
+type CanonicalHasher[K any] interface {
+	Hasher[K]
+	Compare(a, b K) int
+}
+
 type Numeric interface {
 	~int | ~int8 | ~int16 | ~int32 | ~int64 |
 		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
@@ -23,12 +37,14 @@ type Numeric interface {
 
 type NumericHasher[T Numeric] struct{}
 
-func (NumericHasher[T]) Equal(a, b T) bool { return a == b }
-func (NumericHasher[T]) Hash(a T) uint64   { return uint64(a) }
+func (NumericHasher[T]) Equal(a, b T) bool  { return a == b }
+func (NumericHasher[T]) Hash(a T) uint64    { return uint64(a) }
+func (NumericHasher[T]) Compare(a, b T) int { return cmp.Compare(a, b) }
 
 type StringHasher[T ~string] struct{}
 
-func (StringHasher[T]) Equal(a, b T) bool { return a == b }
+func (StringHasher[T]) Equal(a, b T) bool  { return a == b }
+func (StringHasher[T]) Compare(a, b T) int { return cmp.Compare(a, b) }
 func (StringHasher[T]) Hash(a T) (res uint64) {
 	// TODO: This is bad because the two halves of the output are
 	//  formed independently by the even and odd characters...
@@ -44,6 +60,9 @@ type PointerHasher[T any] struct{}
 
 func (PointerHasher[T]) Equal(a, b *T) bool { return a == b }
 func (PointerHasher[T]) Hash(p *T) uint64   { return uint64(uintptr(unsafe.Pointer(p))) }
+func (h PointerHasher[T]) Compare(a, b *T) int {
+	return cmp.Compare(h.Hash(a), h.Hash(b))
+}
 
 // ComparableHasher hashes any comparable type using maphash.Comparable.
 // Each instance carries its own seed; create instances with NewComparableHasher.
@@ -56,3 +75,49 @@ func NewComparableHasher[T comparable]() ComparableHasher[T] {
 
 func (h ComparableHasher[T]) Equal(a, b T) bool { return a == b }
 func (h ComparableHasher[T]) Hash(a T) uint64   { return maphash.Comparable(h.seed, a) }
+
+// TreeHasher hashes maps by their contents, such that maps can be used as keys
+// in other maps, as in Tree[Tree[K, V], W]. Values are hashed and compared with
+// the Values hasher, and keys with the hasher of the maps.
+//
+// TreeHashers constructed with NewTreeHasher cache content hashes in the nodes
+// of the hashed maps, so hashing a map that shares most of its structure with
+// a previously hashed map is cheap, and Equal rejects maps with different
+// cached hashes early. A cached hash is only used by the TreeHasher (and its
+// copies) that computed it. TreeHashers that are constructed directly do not
+// cache hashes.
+type TreeHasher[K, V any] struct {
+	Values Hasher[V]
+	owner  *hashOwner
+}
+
+// NewTreeHasher constructs a TreeHasher that hashes and compares values with
+// the given hasher, and caches content hashes.
+func NewTreeHasher[K, V any](values Hasher[V]) TreeHasher[K, V] {
+	return TreeHasher[K, V]{values, new(hashOwner)}
+}
+
+func (h TreeHasher[K, V]) Equal(a, b Tree[K, V]) bool {
+	return hashedEqual(a.root, b.root, a.hasher, h.Values.Equal, h.owner)
+}
+
+func (h TreeHasher[K, V]) Hash(t Tree[K, V]) uint64 {
+	return contentHash(t.root, h.Values.Hash, h.owner)
+}
+
+// SetHasher hashes sets by their contents, such that sets can be used as
+// elements of other sets, as in Set[Set[K]]. Content hashes are cached in the
+// nodes of the hashed sets.
+type SetHasher[K any] struct{}
+
+// setHashOwner owns the content hashes cached by all SetHashers, which hash
+// sets identically.
+var setHashOwner = new(hashOwner)
+
+func (SetHasher[K]) Equal(a, b Set[K]) bool {
+	return hashedEqual(a.m.root, b.m.root, a.m.hasher, func(_, _ struct{}) bool { return true }, setHashOwner)
+}
+
+func (SetHasher[K]) Hash(s Set[K]) uint64 {
+	return contentHash(s.m.root, func(struct{}) uint64 { return 0 }, setHashOwner)
+}
@@ -0,0 +1,155 @@
+package pmmap
+
+import (
+	"runtime"
+	"sync"
+	"weak"
+)
+
+// Interner hash-conses the nodes of maps, such that maps with equal contents
+// that are interned by the same Interner share a single root.
+//
+// After interning, Equal takes constant time on maps with equal contents, and
+// merges can reuse substantially more structure. The Interner only refers to
+// nodes weakly, and its entries are removed automatically once no maps refer
+// to the nodes anymore.
+//
+// All maps interned by an Interner must use equivalent hashers.
+// An Interner is safe for concurrent use by multiple goroutines.
+type Interner[K, V any] struct {
+	eq func(V, V) bool
+
+	mu       sync.Mutex
+	leaves   map[keyt][]weak.Pointer[leaf[K, V]]
+	branches map[branchKey[K, V]]weak.Pointer[branch[K, V]]
+}
+
+// nodeID identifies a node without keeping it alive.
+type nodeID[K, V any] struct {
+	leaf   weak.Pointer[leaf[K, V]]
+	branch weak.Pointer[branch[K, V]]
+}
+
+// branchKey identifies a branch by its prefix and its (interned) subtrees.
+type branchKey[K, V any] struct {
+	prefix, branchBit keyt
+	left, right       nodeID[K, V]
+}
+
+// NewInterner constructs an Interner that compares values with `eq`.
+func NewInterner[K, V any](eq func(V, V) bool) *Interner[K, V] {
+	return &Interner[K, V]{
+		eq:       eq,
+		leaves:   make(map[keyt][]weak.Pointer[leaf[K, V]]),
+		branches: make(map[branchKey[K, V]]weak.Pointer[branch[K, V]]),
+	}
+}
+
+// Intern returns a map that is equal to the given map, and whose nodes are
+// shared with all other maps with equal contents returned by the Interner.
+//
+// Subtrees that were already interned are not traversed.
+func (in *Interner[K, V]) Intern(tree Tree[K, V]) Tree[K, V] {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	tree.root = in.intern(tree.root, tree.hasher)
+	return tree
+}
+
+// Len returns the number of nodes in the Interner's table.
+func (in *Interner[K, V]) Len() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	n := len(in.branches)
+	for _, bucket := range in.leaves {
+		n += len(bucket)
+	}
+	return n
+}
+
+func idOf[K, V any](n node[K, V]) nodeID[K, V] {
+	switch n := n.(type) {
+	case *leaf[K, V]:
+		return nodeID[K, V]{leaf: weak.Make(n)}
+	case *branch[K, V]:
+		return nodeID[K, V]{branch: weak.Make(n)}
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
+// intern returns the canonical node for n. The caller must hold in.mu.
+func (in *Interner[K, V]) intern(n node[K, V], hasher Hasher[K]) node[K, V] {
+	switch n := n.(type) {
+	case nil:
+		return nil
+
+	case *leaf[K, V]:
+		for _, wp := range in.leaves[n.key] {
+			if lf := wp.Value(); lf != nil && (lf == n || equal[K, V](lf, n, hasher, in.eq)) {
+				return lf
+			}
+		}
+
+		wp := weak.Make(n)
+		in.leaves[n.key] = append(in.leaves[n.key], wp)
+		runtime.AddCleanup(n, in.removeLeaf, leafCleanup[K, V]{n.key, wp})
+		return n
+
+	case *branch[K, V]:
+		// Canonical branches have canonical subtrees, so n is canonical if it
+		// is registered under its own subtrees.
+		key := branchKey[K, V]{n.prefix, n.branchBit, idOf(n.left), idOf(n.right)}
+		if br := in.branches[key].Value(); br == n {
+			return n
+		}
+
+		l, r := in.intern(n.left, hasher), in.intern(n.right, hasher)
+		key.left, key.right = idOf(l), idOf(r)
+		if br := in.branches[key].Value(); br != nil {
+			return br
+		}
+
+		if l != n.left || r != n.right {
+			n = newBranch(n.prefix, n.branchBit, l, r)
+		}
+		in.branches[key] = weak.Make(n)
+		runtime.AddCleanup(n, in.removeBranch, key)
+		return n
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
+type leafCleanup[K, V any] struct {
+	key keyt
+	wp  weak.Pointer[leaf[K, V]]
+}
+
+func (in *Interner[K, V]) removeLeaf(c leafCleanup[K, V]) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	bucket := in.leaves[c.key]
+	for i, wp := range bucket {
+		if wp == c.wp {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			break
+		}
+	}
+
+	if len(bucket) == 0 {
+		delete(in.leaves, c.key)
+	} else {
+		in.leaves[c.key] = bucket
+	}
+}
+
+func (in *Interner[K, V]) removeBranch(key branchKey[K, V]) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	// The entry may have been replaced by a live branch in the meantime
+	if in.branches[key].Value() == nil {
+		delete(in.branches, key)
+	}
+}
@@ -0,0 +1,82 @@
+package pmmap
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestInterner(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		in := NewInterner[int, int](cmpEq[int])
+		for range 20 {
+			keys := rand.Perm(2 * N)[:N]
+			a, b := New[int](hasher), New[int](hasher)
+			for _, k := range keys {
+				a = a.Insert(k, k%3)
+			}
+			// Insert in a different order to obtain different leaf buckets
+			for i := len(keys) - 1; i >= 0; i-- {
+				b = b.Insert(keys[i], keys[i]%3)
+			}
+
+			ia, ib := in.Intern(a), in.Intern(b)
+			if !ia.Equal(a, cmpEq[int]) {
+				t.Fatal("Expected", ia, "to equal", a)
+			} else if ia.root != ib.root {
+				t.Fatalf("Expected %p to be %p", ia.root, ib.root)
+			}
+
+			// Interning again is the identity
+			if ic := in.Intern(ia); ic.root != ia.root {
+				t.Fatalf("Expected %p to be %p", ic.root, ia.root)
+			}
+
+			c := b.Insert(keys[0], -1)
+			if ic := in.Intern(c); ic.root == ia.root || ic.Equal(ia, cmpEq[int]) {
+				t.Fatal("Expected", ic, "to differ from", ia)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		in := NewInterner[int, int](cmpEq[int])
+		a, b := New[int](intHasher), New[int](intHasher)
+		for i := range N {
+			a, b = a.Insert(i, i), b.Insert(i, i)
+		}
+		a, b = in.Intern(a), in.Intern(b.Insert(N, N))
+
+		// Only the path to the new key differs
+		ar, br := a.root.(*branch[int, int]), b.root.(*branch[int, int])
+		if ar.left != br.left {
+			t.Errorf("Expected %p to be %p", ar.left, br.left)
+		}
+	})
+
+	t.Run("Collect", func(t *testing.T) {
+		in := NewInterner[int, int](cmpEq[int])
+		tree := New[int](intHasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+		tree = in.Intern(tree)
+		if n := in.Len(); n != 2*N-1 {
+			t.Fatalf("Expected %d interned nodes, got %d", 2*N-1, n)
+		}
+		runtime.KeepAlive(tree)
+
+		// Cleanups run asynchronously after the nodes are collected
+		for range 100 {
+			runtime.GC()
+			if in.Len() == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Errorf("Expected empty interner, got %d nodes", in.Len())
+	})
+}
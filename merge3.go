@@ -0,0 +1,60 @@
+package pmmap
+
+// Merge3 performs a three-way merge of two maps, a and b, that were derived
+// from a common ancestor, base. Changes that were only made in one of the maps
+// are included in the result, including removals. Values are compared with
+// `eq`.
+//
+// Keys that were changed differently in the two maps are conflicts, and are
+// mapped to the result of `resolve`, which receives the changes made to the
+// key in a and in b. If the returned flag is false, the key is removed.
+// Keys that were changed in the same way in both maps are not conflicts.
+//
+// The changes are found with Diff, so unchanged subtrees that are shared with
+// base are skipped, and the merge takes time proportional to the number of
+// changes.
+func Merge3[K, V any](base, a, b Tree[K, V], eq func(V, V) bool, resolve func(a, b Change[K, V]) (V, bool)) Tree[K, V] {
+	if a.root == b.root || b.root == base.root {
+		return a
+	} else if a.root == base.root {
+		return b
+	}
+
+	res := a.ToBuilder()
+	for bch := range base.Diff(b, eq) {
+		av, inA := a.Lookup(bch.Key)
+		_, inBase := base.Lookup(bch.Key)
+		if inA == inBase && (!inA || eq(av, bch.Old)) {
+			// The key is unchanged in a, so take the change from b
+			if bch.Kind == Removed {
+				res.Remove(bch.Key)
+			} else {
+				res.Insert(bch.Key, bch.New)
+			}
+			continue
+		}
+
+		inB := bch.Kind != Removed
+		if inA == inB && (!inA || eq(av, bch.New)) {
+			// Both maps made the same change
+			continue
+		}
+
+		ach := Change[K, V]{Key: bch.Key, Old: bch.Old, New: av}
+		switch {
+		case !inBase:
+			ach.Kind = Added
+		case !inA:
+			ach.Kind = Removed
+		default:
+			ach.Kind = Changed
+		}
+
+		if v, keep := resolve(ach, bch); keep {
+			res.Insert(bch.Key, v)
+		} else {
+			res.Remove(bch.Key)
+		}
+	}
+	return res.Freeze()
+}
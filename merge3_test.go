@@ -0,0 +1,99 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	N := 100
+
+	type state struct {
+		v     int
+		found bool
+	}
+	edit := func(tree Tree[int, int]) Tree[int, int] {
+		for range 10 {
+			k := rand.Intn(2 * N)
+			if rand.Intn(2) == 0 {
+				tree = tree.Remove(k)
+			} else {
+				tree = tree.Insert(k, rand.Intn(3))
+			}
+		}
+		return tree
+	}
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		for range 20 {
+			base := New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					base = base.Insert(i, rand.Intn(3))
+				}
+			}
+			a, b := edit(base), edit(base)
+
+			resolve := func(ach, bch Change[int, int]) (int, bool) {
+				if ach.Key != bch.Key {
+					t.Fatalf("Resolving different keys %d and %d", ach.Key, bch.Key)
+				}
+				av, inA := a.Lookup(ach.Key)
+				bv, inB := b.Lookup(bch.Key)
+				if inA == inB && (!inA || av == bv) {
+					t.Fatalf("Resolving non-conflict for key %d", ach.Key)
+				} else if ach.New != av || bch.New != bv {
+					t.Fatalf("Expected changes to %d and %d, got %v and %v", av, bv, ach, bch)
+				}
+				return ach.New + bch.New + 10, ach.Key%2 == 0
+			}
+
+			expect := New[int](hasher)
+			for k := range 2 * N {
+				var s [3]state
+				for i, tree := range []Tree[int, int]{base, a, b} {
+					s[i].v, s[i].found = tree.Lookup(k)
+				}
+
+				res := s[1]
+				if s[1] == s[0] {
+					res = s[2]
+				} else if s[2] != s[0] && s[1] != s[2] {
+					res.v, res.found = s[1].v+s[2].v+10, k%2 == 0
+				}
+				if res.found {
+					expect = expect.Insert(k, res.v)
+				}
+			}
+
+			if res := Merge3(base, a, b, cmpEq[int], resolve); !res.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", expect)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		base := New[int](intHasher)
+		for i := range N {
+			base = base.Insert(i, i)
+		}
+		a := base.Insert(0, -1)
+
+		if res := Merge3(base, a, base, cmpEq[int], nil); res.root != a.root {
+			t.Errorf("Expected %p to be %p", res.root, a.root)
+		}
+		if res := Merge3(base, base, a, cmpEq[int], nil); res.root != a.root {
+			t.Errorf("Expected %p to be %p", res.root, a.root)
+		}
+
+		// Only the path to the key changed in b is rebuilt
+		b := base.Remove(N - 1)
+		res := Merge3(base, a, b, cmpEq[int], nil)
+		if rr, ar := res.root.(*branch[int, int]), a.root.(*branch[int, int]); rr.left != ar.left {
+			t.Errorf("Expected %p to be %p", rr.left, ar.left)
+		}
+		if _, found := res.Lookup(N - 1); found || res.Size() != N-1 {
+			t.Error("Expected", N-1, "to be removed from", res)
+		}
+	})
+}
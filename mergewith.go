@@ -0,0 +1,343 @@
+package pmmap
+
+import "slices"
+
+// MissingTactic decides what [Tree.MergeWith] does with keys that are only
+// present in one of the two maps. The zero value keeps the keys.
+//
+// Tactics act on whole subtrees: subtrees that are kept or dropped are not
+// traversed.
+type MissingTactic[K, V any] struct {
+	drop bool
+	f    func(K, V) (V, bool)
+}
+
+// KeepMissing keeps keys that are only present in one map, with their values.
+func KeepMissing[K, V any]() MissingTactic[K, V] {
+	return MissingTactic[K, V]{}
+}
+
+// DropMissing removes keys that are only present in one map.
+func DropMissing[K, V any]() MissingTactic[K, V] {
+	return MissingTactic[K, V]{drop: true}
+}
+
+// MapMissing maps keys that are only present in one map to `f(k, v)`.
+// If the returned flag is false, the key is removed instead.
+func MapMissing[K, V any](f func(K, V) (V, bool)) MissingTactic[K, V] {
+	return MissingTactic[K, V]{f: f}
+}
+
+// apply the tactic to the subtree rooted at n.
+func (t MissingTactic[K, V]) apply(n node[K, V]) node[K, V] {
+	if t.drop {
+		return nil
+	} else if t.f == nil {
+		return n
+	}
+	return mapMaybe(n, t.f)
+}
+
+// applyPair applies the tactic to a single key-value pair and appends the
+// result, if any, to values.
+func (t MissingTactic[K, V]) applyPair(values []pair[K, V], pr pair[K, V]) []pair[K, V] {
+	if t.drop {
+		return values
+	} else if t.f != nil {
+		var keep bool
+		if pr.value, keep = t.f(pr.key, pr.value); !keep {
+			return values
+		}
+	}
+	return append(values, pr)
+}
+
+// MergeWith merges two maps, deciding separately what to do with keys that are
+// only in this map (`onlyLeft`), keys that are only in the other map
+// (`onlyRight`), and keys that are in both maps. Keys in both maps are mapped
+// to `both(k, a, b)`, where `a` is the value from this map, or removed if the
+// returned flag is false.
+//
+// Union, intersection, difference and overlay are special cases of MergeWith.
+// Unlike Merge, `both` is also called for keys in shared subtrees, so it need
+// not be idempotent.
+func (tree Tree[K, V]) MergeWith(
+	other Tree[K, V],
+	onlyLeft, onlyRight MissingTactic[K, V],
+	both func(k K, a, b V) (V, bool),
+) Tree[K, V] {
+	m := merger[K, V]{tree.hasher, onlyLeft, onlyRight, both}
+	tree.root = m.merge(tree.root, other.root)
+	return tree
+}
+
+// Combine merges two maps with an arbitrary (for instance non-idempotent)
+// operator. Keys in both maps are mapped to `f(a, b)`, where `a` is the value
+// from this map, and keys in only one map keep their value.
+//
+// One-sided subtrees are returned by reference, but unlike Merge, `f` is also
+// applied to the keys in shared subtrees: combining a map of counts with
+// itself with `+` doubles every count.
+func (tree Tree[K, V]) Combine(other Tree[K, V], f func(a, b V) V) Tree[K, V] {
+	return tree.MergeWith(other, KeepMissing[K, V](), KeepMissing[K, V](), func(_ K, a, b V) (V, bool) {
+		return f(a, b), true
+	})
+}
+
+// Overlay returns a map with the keys of both maps, where keys in this map are
+// mapped to their values in this map, and the remaining keys are mapped to
+// their values in `under`.
+//
+// Like Merge, shared subtrees and subtrees that only occur in one of the maps
+// are returned by reference.
+func (tree Tree[K, V]) Overlay(under Tree[K, V]) Tree[K, V] {
+	tree.root = overlay(tree.root, under.root, tree.hasher)
+	return tree
+}
+
+// merger holds the parameters of MergeWith.
+type merger[K, V any] struct {
+	hasher              Hasher[K]
+	onlyLeft, onlyRight MissingTactic[K, V]
+	both                func(K, V, V) (V, bool)
+}
+
+func (m merger[K, V]) merge(a, b node[K, V]) node[K, V] {
+	if a == nil {
+		return m.onlyRight.apply(b)
+	} else if b == nil {
+		return m.onlyLeft.apply(a)
+	} else if a == b {
+		// Shared subtrees contain no one-sided keys
+		return mapMaybe(a, func(k K, v V) (V, bool) { return m.both(k, v, v) })
+	}
+
+	switch s := a.(type) {
+	case *leaf[K, V]:
+		switch t := b.(type) {
+		case *leaf[K, V]:
+			if s.key == t.key {
+				return m.mergeLeaves(s, t)
+			}
+
+		case *branch[K, V]:
+			if t.match(s.key) {
+				// t contains s
+				if zeroBit(s.key, t.branchBit) {
+					return rebuild(t, m.merge(s, t.left), m.onlyRight.apply(t.right))
+				}
+				return rebuild(t, m.onlyRight.apply(t.left), m.merge(s, t.right))
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+
+	case *branch[K, V]:
+		switch t := b.(type) {
+		case *leaf[K, V]:
+			if s.match(t.key) {
+				// s contains t
+				if zeroBit(t.key, s.branchBit) {
+					return rebuild(s, m.merge(s.left, t), m.onlyLeft.apply(s.right))
+				}
+				return rebuild(s, m.onlyLeft.apply(s.left), m.merge(s.right, t))
+			}
+
+		case *branch[K, V]:
+			if s.branchBit == t.branchBit && s.prefix == t.prefix {
+				return rebuild(s, m.merge(s.left, t.left), m.merge(s.right, t.right))
+			} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+				// s contains t
+				if zeroBit(t.prefix, s.branchBit) {
+					return rebuild(s, m.merge(s.left, t), m.onlyLeft.apply(s.right))
+				}
+				return rebuild(s, m.onlyLeft.apply(s.left), m.merge(s.right, t))
+			} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+				// t contains s
+				if zeroBit(s.prefix, t.branchBit) {
+					return rebuild(t, m.merge(s, t.left), m.onlyRight.apply(t.right))
+				}
+				return rebuild(t, m.onlyRight.apply(t.left), m.merge(s, t.right))
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	// prefixes disagree
+	l, r := m.onlyLeft.apply(a), m.onlyRight.apply(b)
+	if l == nil {
+		return r
+	} else if r == nil {
+		return l
+	}
+	return join(prefixOf(a), prefixOf(b), l, r)
+}
+
+// mergeLeaves merges two leaves with the same hash.
+func (m merger[K, V]) mergeLeaves(s, t *leaf[K, V]) node[K, V] {
+	var values []pair[K, V]
+	matched := make([]bool, len(t.values))
+
+FOUND:
+	for _, pr := range s.values {
+		for i, tpr := range t.values {
+			if m.hasher.Equal(pr.key, tpr.key) {
+				matched[i] = true
+				if v, keep := m.both(pr.key, pr.value, tpr.value); keep {
+					values = append(values, pair[K, V]{pr.key, v})
+				}
+				continue FOUND
+			}
+		}
+
+		values = m.onlyLeft.applyPair(values, pr)
+	}
+
+	for i, tpr := range t.values {
+		if !matched[i] {
+			n := len(values)
+			if values = m.onlyRight.applyPair(values, tpr); len(values) > n {
+				// Move the pair to its place in the bucket
+				values = slices.Insert(values[:n], bucketIndex(values[:n], tpr.key, m.hasher), values[n])
+			}
+		}
+	}
+
+	return mkLeaf(s.key, values)
+}
+
+// overlay merges two nodes, preferring the values in a.
+func overlay[K, V any](a, b node[K, V], hasher Hasher[K]) node[K, V] {
+	if a == b || b == nil {
+		return a
+	} else if a == nil {
+		return b
+	}
+
+	switch s := a.(type) {
+	case *leaf[K, V]:
+		switch t := b.(type) {
+		case *leaf[K, V]:
+			if s.key == t.key {
+				values := s.values
+			FOUND:
+				for _, tpr := range t.values {
+					for _, pr := range s.values {
+						if hasher.Equal(pr.key, tpr.key) {
+							continue FOUND
+						}
+					}
+
+					values = slices.Insert(slices.Clip(values), bucketIndex(values, tpr.key, hasher), tpr)
+				}
+
+				if len(values) == len(s.values) {
+					return s
+				}
+				return mkLeaf(s.key, values)
+			}
+
+		case *branch[K, V]:
+			if t.match(s.key) {
+				// t contains s
+				if zeroBit(s.key, t.branchBit) {
+					return rebuild(t, overlay(a, t.left, hasher), t.right)
+				}
+				return rebuild(t, t.left, overlay(a, t.right, hasher))
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+
+	case *branch[K, V]:
+		switch t := b.(type) {
+		case *leaf[K, V]:
+			if s.match(t.key) {
+				// s contains t
+				if zeroBit(t.key, s.branchBit) {
+					return rebuild(s, overlay(s.left, b, hasher), s.right)
+				}
+				return rebuild(s, s.left, overlay(s.right, b, hasher))
+			}
+
+		case *branch[K, V]:
+			if s.branchBit == t.branchBit && s.prefix == t.prefix {
+				l, r := overlay(s.left, t.left, hasher), overlay(s.right, t.right, hasher)
+				if l == t.left && r == t.right {
+					return t
+				}
+				return rebuild(s, l, r)
+			} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+				// s contains t
+				if zeroBit(t.prefix, s.branchBit) {
+					return rebuild(s, overlay(s.left, b, hasher), s.right)
+				}
+				return rebuild(s, s.left, overlay(s.right, b, hasher))
+			} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+				// t contains s
+				if zeroBit(s.prefix, t.branchBit) {
+					return rebuild(t, overlay(a, t.left, hasher), t.right)
+				}
+				return rebuild(t, t.left, overlay(a, t.right, hasher))
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	// prefixes disagree
+	return join(prefixOf(a), prefixOf(b), a, b)
+}
+
+// rebuild returns a branch like b with the given subtrees, reusing b if the
+// subtrees are unchanged.
+func rebuild[K, V any](b *branch[K, V], l, r node[K, V]) node[K, V] {
+	if l == b.left && r == b.right {
+		return b
+	}
+	return br(b.prefix, b.branchBit, l, r)
+}
+
+// prefixOf returns the prefix shared by all keys in the subtree rooted at n.
+func prefixOf[K, V any](n node[K, V]) keyt {
+	switch n := n.(type) {
+	case *leaf[K, V]:
+		return n.key
+	case *branch[K, V]:
+		return n.prefix
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
+// mapMaybe maps every key-value pair in the subtree rooted at n with f, and
+// removes the pairs for which f returns false.
+func mapMaybe[K, V any](n node[K, V], f func(K, V) (V, bool)) node[K, V] {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case *leaf[K, V]:
+		var values []pair[K, V]
+		for _, pr := range n.values {
+			if v, keep := f(pr.key, pr.value); keep {
+				values = append(values, pair[K, V]{pr.key, v})
+			}
+		}
+		return mkLeaf(n.key, values)
+	case *branch[K, V]:
+		return br(n.prefix, n.branchBit, mapMaybe(n.left, f), mapMaybe(n.right, f))
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
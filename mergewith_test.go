@@ -0,0 +1,203 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMergeWith(t *testing.T) {
+	N := 100
+
+	shift := func(k, v int) (int, bool) { return v + k, k%2 == 0 }
+	tactics := map[string]MissingTactic[int, int]{
+		"Keep": KeepMissing[int, int](),
+		"Drop": DropMissing[int, int](),
+		"Map":  MapMissing(shift),
+	}
+	// Reference implementation of a tactic on a single key
+	applyRef := func(name string, k, v int) (int, bool) {
+		switch name {
+		case "Keep":
+			return v, true
+		case "Drop":
+			return 0, false
+		default:
+			return shift(k, v)
+		}
+	}
+	both := func(k, a, b int) (int, bool) { return k*a - b, k%3 != 0 }
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		for range 10 {
+			a, b := New[int](hasher), New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					a = a.Insert(i, rand.Intn(10))
+				}
+				if rand.Intn(2) == 0 {
+					b = b.Insert(i, rand.Intn(10))
+				}
+			}
+
+			for ln, lt := range tactics {
+				for rn, rt := range tactics {
+					expect := New[int](hasher)
+					for i := range 2 * N {
+						av, ainb := a.Lookup(i)
+						bv, binb := b.Lookup(i)
+						var (
+							v    int
+							keep bool
+						)
+						switch {
+						case ainb && binb:
+							v, keep = both(i, av, bv)
+						case ainb:
+							v, keep = applyRef(ln, i, av)
+						case binb:
+							v, keep = applyRef(rn, i, bv)
+						}
+						if keep {
+							expect = expect.Insert(i, v)
+						}
+					}
+
+					if res := a.MergeWith(b, lt, rt, both); !res.Equal(expect, cmpEq[int]) {
+						t.Fatalf("MergeWith(%s, %s) = %v, expected %v", ln, rn, res, expect)
+					}
+				}
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+
+		// Keys in shared subtrees are combined
+		calls := 0
+		res := a.MergeWith(a, KeepMissing[int, int](), KeepMissing[int, int](), func(k, x, y int) (int, bool) {
+			calls++
+			return x + y, true
+		})
+		if calls != N {
+			t.Fatalf("Expected %d calls, got %d", N, calls)
+		}
+		if v, _ := res.Lookup(7); v != 14 {
+			t.Errorf("Expected 14, got %d", v)
+		}
+
+		// Kept one-sided subtrees are returned by reference
+		b := New[int](intHasher).Insert(N, N)
+		res = a.MergeWith(b, KeepMissing[int, int](), DropMissing[int, int](), nil)
+		if res.root != a.root {
+			t.Errorf("Expected %p to be %p", res.root, a.root)
+		}
+	})
+}
+
+func TestCombine(t *testing.T) {
+	N := 100
+	add := func(a, b int) int { return a + b }
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		for range 20 {
+			a := New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					a = a.Insert(i, rand.Intn(10))
+				}
+			}
+			// b shares most of its structure with a
+			b := a
+			for range 10 {
+				i := rand.Intn(2 * N)
+				b = b.Insert(i, rand.Intn(10))
+			}
+
+			expect := New[int](hasher)
+			for i := range 2 * N {
+				av, ainb := a.Lookup(i)
+				bv, binb := b.Lookup(i)
+				if ainb || binb {
+					expect = expect.Insert(i, av+bv)
+				}
+			}
+
+			if res := a.Combine(b, add); !res.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", expect)
+			}
+		}
+	}
+
+	t.Run("Self", func(t *testing.T) {
+		counts := New[int](intHasher)
+		for i := range N {
+			counts = counts.Insert(i, i)
+		}
+
+		doubled := counts.Combine(counts, add)
+		for k, v := range counts.All() {
+			if d, _ := doubled.Lookup(k); d != 2*v {
+				t.Fatalf("Expected %d for key %d, got %d", 2*v, k, d)
+			}
+		}
+	})
+}
+
+func TestOverlay(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		for range 20 {
+			top, under := New[int](hasher), New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					top = top.Insert(i, rand.Intn(10))
+				}
+				if rand.Intn(2) == 0 {
+					under = under.Insert(i, rand.Intn(10))
+				}
+			}
+
+			expect := under
+			for k, v := range top.All() {
+				expect = expect.Insert(k, v)
+			}
+
+			if res := top.Overlay(under); !res.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", expect)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		under := New[int](intHasher)
+		for i := range N {
+			under = under.Insert(i, i)
+		}
+
+		if res := under.Overlay(under); res.root != under.root {
+			t.Errorf("Expected %p to be %p", res.root, under.root)
+		}
+
+		// Overriding a key only rebuilds the path to it
+		top := under.Insert(0, -1)
+		res := top.Overlay(under)
+		if res.root != top.root {
+			t.Errorf("Expected %p to be %p", res.root, top.root)
+		}
+
+		// The root splits the keys below 64 from the rest
+		top = New[int](intHasher).Insert(0, -1)
+		res = top.Overlay(under)
+		if v, _ := res.Lookup(0); v != -1 || res.Size() != N {
+			t.Fatalf("Expected %d keys with 0 ↦ -1, got %v", N, res)
+		}
+		if rr, ur := res.root.(*branch[int, int]), under.root.(*branch[int, int]); rr.right != ur.right {
+			t.Errorf("Expected %p to be %p", rr.right, ur.right)
+		}
+	})
+}
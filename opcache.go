@@ -0,0 +1,390 @@
+package pmmap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// OpCache memoizes the results of binary operations on pairs of subtrees, as
+// in the operation caches of BDD packages. Repeatedly merging or comparing the
+// same subtrees, for instance in fixpoint computations, then takes constant
+// time per pair of subtrees.
+//
+// The results of an operation depend on the function that is passed to it, so
+// a cache must only be used with a single MergeFunc and a single equality
+// function. The cache holds at most a fixed number of results, and evicts the
+// least recently used results first. Cached results keep the involved
+// subtrees alive.
+//
+// An OpCache is safe for concurrent use by multiple goroutines.
+type OpCache[K, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[opKey[K, V]]*list.Element
+	lru      list.List // Elements are *opEntry[K, V], most recently used first
+}
+
+type opKind uint8
+
+const (
+	opMerge opKind = iota
+	opEqual
+	opIntersect
+	opDifference
+	opSubmap
+	opIntersectionSize
+)
+
+type opKey[K, V any] struct {
+	op   opKind
+	a, b node[K, V]
+}
+
+type opEntry[K, V any] struct {
+	key  opKey[K, V]
+	res  node[K, V]
+	flag bool
+	size int
+}
+
+// NewOpCache constructs an operation cache that holds at most capacity results.
+func NewOpCache[K, V any](capacity int) *OpCache[K, V] {
+	if capacity < 1 {
+		panic("pmmap: OpCache requires a positive capacity")
+	}
+	return &OpCache[K, V]{
+		capacity: capacity,
+		entries:  make(map[opKey[K, V]]*list.Element),
+	}
+}
+
+// Len returns the number of results in the cache.
+func (c *OpCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Clear removes all results from the cache.
+func (c *OpCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+}
+
+func (c *OpCache[K, V]) lookup(key opKey[K, V]) (opEntry[K, V], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return *el.Value.(*opEntry[K, V]), true
+	}
+	return opEntry[K, V]{}, false
+}
+
+func (c *OpCache[K, V]) store(entry opEntry[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.key]; ok {
+		// Another goroutine computed the same result
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	if len(c.entries) >= c.capacity {
+		oldest := c.lru.Back()
+		delete(c.entries, c.lru.Remove(oldest).(*opEntry[K, V]).key)
+	}
+	c.entries[entry.key] = c.lru.PushFront(&entry)
+}
+
+// MergeCached is like Merge, but uses the cache to skip merging pairs of
+// subtrees that have been merged before.
+func (tree Tree[K, V]) MergeCached(other Tree[K, V], f MergeFunc[V], cache *OpCache[K, V]) Tree[K, V] {
+	tree.root, _ = cachedOps[K, V]{tree.hasher, cache}.merge(tree.root, other.root, f)
+	return tree
+}
+
+// EqualCached is like Equal, but uses the cache to skip comparing pairs of
+// subtrees that have been compared before.
+func (tree Tree[K, V]) EqualCached(other Tree[K, V], f func(V, V) bool, cache *OpCache[K, V]) bool {
+	return cachedOps[K, V]{tree.hasher, cache}.equal(tree.root, other.root, f)
+}
+
+// IntersectCached is like Intersect, but uses the cache to skip intersecting
+// pairs of subtrees that have been intersected before.
+func (tree Tree[K, V]) IntersectCached(other Tree[K, V], f MergeFunc[V], cache *OpCache[K, V]) Tree[K, V] {
+	tree.root = cachedOps[K, V]{tree.hasher, cache}.intersect(tree.root, other.root, f)
+	return tree
+}
+
+// UnionCached is like Union, but uses the cache to skip merging pairs of
+// subtrees that have been merged before.
+func (s Set[K]) UnionCached(other Set[K], cache *OpCache[K, struct{}]) Set[K] {
+	s.m = s.m.MergeCached(other.m, func(a, _ struct{}) (struct{}, bool) {
+		return a, true
+	}, cache)
+	return s
+}
+
+// EqualCached is like Equal, but uses the cache to skip comparing pairs of
+// subtrees that have been compared before.
+func (s Set[K]) EqualCached(other Set[K], cache *OpCache[K, struct{}]) bool {
+	return s.m.EqualCached(other.m, func(_, _ struct{}) bool { return true }, cache)
+}
+
+// IntersectCached is like Intersect, but uses the cache to skip intersecting
+// pairs of subtrees that have been intersected before.
+func (s Set[K]) IntersectCached(other Set[K], cache *OpCache[K, struct{}]) Set[K] {
+	s.m = s.m.IntersectCached(other.m, func(a, _ struct{}) (struct{}, bool) {
+		return a, true
+	}, cache)
+	return s
+}
+
+// DifferenceCached is like Difference, but uses the cache to skip subtracting
+// pairs of subtrees that have been subtracted before.
+func (s Set[K]) DifferenceCached(other Set[K], cache *OpCache[K, struct{}]) Set[K] {
+	s.m.root = cachedOps[K, struct{}]{s.m.hasher, cache}.difference(s.m.root, other.m.root)
+	return s
+}
+
+// IsSubsetCached is like IsSubset, but uses the cache to skip comparing pairs
+// of subtrees that have been compared before.
+func (s Set[K]) IsSubsetCached(other Set[K], cache *OpCache[K, struct{}]) bool {
+	return cachedOps[K, struct{}]{s.m.hasher, cache}.isSubmap(s.m.root, other.m.root, func(_, _ struct{}) bool {
+		return true
+	})
+}
+
+// IntersectionSizeCached is like IntersectionSize, but uses the cache to skip
+// counting the common elements of pairs of subtrees that have been counted
+// before.
+func (s Set[K]) IntersectionSizeCached(other Set[K], cache *OpCache[K, struct{}]) int {
+	if s.m.root == nil || other.m.root == nil {
+		return 0
+	}
+	return cachedOps[K, struct{}]{s.m.hasher, cache}.intersectionSize(s.m.root, other.m.root)
+}
+
+// cachedOps implements memoized versions of the binary operations. Only
+// results for pairs of branches are cached; leaves are processed directly.
+type cachedOps[K, V any] struct {
+	hasher Hasher[K]
+	cache  *OpCache[K, V]
+}
+
+func (c cachedOps[K, V]) merge(a, b node[K, V], f MergeFunc[V]) (node[K, V], bool) {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t {
+		return merge(a, b, c.hasher, f)
+	}
+
+	key := opKey[K, V]{opMerge, a, b}
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.res, entry.flag
+	}
+
+	res, eq := c.mergeBranches(s, t, f)
+	c.cache.store(opEntry[K, V]{key: key, res: res, flag: eq})
+	return res, eq
+}
+
+// mergeBranches mirrors the handling of branches in merge.
+func (c cachedOps[K, V]) mergeBranches(s, t *branch[K, V], f MergeFunc[V]) (node[K, V], bool) {
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		l, leq := c.merge(s.left, t.left, f)
+		r, req := c.merge(s.right, t.right, f)
+		return mergeBranches(s, t, l, leq, r, req)
+	}
+
+	if s.branchBit > t.branchBit {
+		s, t = t, s
+	}
+
+	if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		l, r := s.left, s.right
+		if zeroBit(t.prefix, s.branchBit) {
+			l, _ = c.merge(l, t, f)
+			if l == s.left {
+				return s, false
+			}
+		} else {
+			r, _ = c.merge(r, t, f)
+			if r == s.right {
+				return s, false
+			}
+		}
+		return newBranch(s.prefix, s.branchBit, l, r), false
+	}
+
+	// prefixes disagree
+	return join(s.prefix, t.prefix, s, t), false
+}
+
+func (c cachedOps[K, V]) equal(a, b node[K, V], f func(V, V) bool) bool {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t {
+		return equal(a, b, c.hasher, f)
+	} else if s.prefix != t.prefix || s.branchBit != t.branchBit || s.size != t.size {
+		return false
+	}
+
+	key := opKey[K, V]{opEqual, a, b}
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.flag
+	}
+
+	eq := c.equal(s.left, t.left, f) && c.equal(s.right, t.right, f)
+	c.cache.store(opEntry[K, V]{key: key, flag: eq})
+	return eq
+}
+
+func (c cachedOps[K, V]) intersect(a, b node[K, V], f MergeFunc[V]) node[K, V] {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t {
+		return intersect(a, b, c.hasher, f)
+	}
+
+	key := opKey[K, V]{opIntersect, a, b}
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.res
+	}
+
+	var res node[K, V]
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		l := c.intersect(s.left, t.left, f)
+		r := c.intersect(s.right, t.right, f)
+		if l == s.left && r == s.right {
+			res = s
+		} else if l == t.left && r == t.right {
+			res = t
+		} else {
+			res = br(s.prefix, s.branchBit, l, r)
+		}
+	} else {
+		if s.branchBit > t.branchBit {
+			s, t = t, s
+		}
+
+		if s.branchBit < t.branchBit && s.match(t.prefix) {
+			// s contains t
+			sub := s.right
+			if zeroBit(t.prefix, s.branchBit) {
+				sub = s.left
+			}
+			res = c.intersect(sub, t, f)
+		}
+	}
+
+	c.cache.store(opEntry[K, V]{key: key, res: res})
+	return res
+}
+
+func (c cachedOps[K, V]) difference(a, b node[K, V]) node[K, V] {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t {
+		return difference(a, b, c.hasher)
+	}
+
+	key := opKey[K, V]{opDifference, a, b}
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.res
+	}
+
+	// Mirrors the handling of branches in difference
+	var res node[K, V] = s
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		res = rebuild(s, c.difference(s.left, t.left), c.difference(s.right, t.right))
+	} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		if zeroBit(t.prefix, s.branchBit) {
+			res = rebuild(s, c.difference(s.left, t), s.right)
+		} else {
+			res = rebuild(s, s.left, c.difference(s.right, t))
+		}
+	} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+		// t contains s
+		if zeroBit(s.prefix, t.branchBit) {
+			res = c.difference(s, t.left)
+		} else {
+			res = c.difference(s, t.right)
+		}
+	}
+
+	c.cache.store(opEntry[K, V]{key: key, res: res})
+	return res
+}
+
+func (c cachedOps[K, V]) isSubmap(a, b node[K, V], leq func(V, V) bool) bool {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t {
+		return isSubmap(a, b, c.hasher, leq)
+	} else if s.size > t.size {
+		return false
+	}
+
+	key := opKey[K, V]{opSubmap, a, b}
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.flag
+	}
+
+	// Mirrors the handling of branches in isSubmap
+	var res bool
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		res = c.isSubmap(s.left, t.left, leq) && c.isSubmap(s.right, t.right, leq)
+	} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+		// t contains s
+		if zeroBit(s.prefix, t.branchBit) {
+			res = c.isSubmap(s, t.left, leq)
+		} else {
+			res = c.isSubmap(s, t.right, leq)
+		}
+	}
+
+	c.cache.store(opEntry[K, V]{key: key, flag: res})
+	return res
+}
+
+// intersectionSize expects non-nil nodes, like the uncached version.
+func (c cachedOps[K, V]) intersectionSize(a, b node[K, V]) int {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t {
+		return intersectionSize(a, b, c.hasher)
+	}
+
+	key := opKey[K, V]{opIntersectionSize, a, b}
+	if entry, ok := c.cache.lookup(key); ok {
+		return entry.size
+	}
+
+	// Mirrors the handling of branches in intersectionSize
+	var res int
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		res = c.intersectionSize(s.left, t.left) + c.intersectionSize(s.right, t.right)
+	} else {
+		if s.branchBit > t.branchBit {
+			s, t = t, s
+		}
+
+		if s.branchBit < t.branchBit && s.match(t.prefix) {
+			// s contains t
+			sub := s.right
+			if zeroBit(t.prefix, s.branchBit) {
+				sub = s.left
+			}
+			res = c.intersectionSize(sub, t)
+		}
+	}
+
+	c.cache.store(opEntry[K, V]{key: key, size: res})
+	return res
+}
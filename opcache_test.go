@@ -0,0 +1,151 @@
+package pmmap
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestOpCache(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+		cache := NewOpCache[int, int](64)
+		for range 20 {
+			a, b := New[int](hasher), New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					a = a.Insert(i, rand.Intn(3))
+				}
+				if rand.Intn(2) == 0 {
+					b = b.Insert(i, rand.Intn(3))
+				}
+			}
+
+			for range 2 {
+				if res, expect := a.MergeCached(b, max, cache), a.Merge(b, max); !res.Equal(expect, cmpEq[int]) {
+					t.Fatal("Expected", res, "to equal", expect)
+				}
+				if res, expect := a.IntersectCached(b, max, cache), a.Intersect(b, max); !res.Equal(expect, cmpEq[int]) {
+					t.Fatal("Expected", res, "to equal", expect)
+				}
+				if res, expect := a.EqualCached(b, cmpEq[int], cache), a.Equal(b, cmpEq[int]); res != expect {
+					t.Fatalf("EqualCached = %v, expected %v", res, expect)
+				}
+			}
+
+			if n := cache.Len(); n > 64 {
+				t.Fatalf("Cache holds %d results, expected at most 64", n)
+			}
+		}
+	}
+
+	t.Run("Hits", func(t *testing.T) {
+		a, b := New[int](intHasher), New[int](intHasher)
+		for i := range N {
+			a, b = a.Insert(i, i), b.Insert(i, i+1)
+		}
+
+		calls := 0
+		f := func(x, y int) (int, bool) {
+			calls++
+			return max(x, y)
+		}
+
+		cache := NewOpCache[int, int](1024)
+		expect := a.MergeCached(b, f, cache)
+		if calls != N {
+			t.Fatalf("Expected %d calls, got %d", N, calls)
+		}
+
+		calls = 0
+		if res := a.MergeCached(b, f, cache); res.root != expect.root || calls != 0 {
+			t.Fatalf("Expected cached result, got %d calls", calls)
+		}
+
+		// Only the path to the updated key is merged again, which involves the
+		// updated leaf and its sibling leaf.
+		calls = 0
+		c := a.Insert(0, -1)
+		if res := c.MergeCached(b, f, cache); !res.Equal(expect, cmpEq[int]) || calls > 2 {
+			t.Fatalf("Expected %v to equal %v with at most 2 calls, got %d calls", res, expect, calls)
+		}
+
+		cache.Clear()
+		if n := cache.Len(); n != 0 {
+			t.Fatalf("Expected empty cache, got %d results", n)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		cache := NewOpCache[int, int](16)
+		trees := make([]Tree[int, int], 8)
+		for i := range trees {
+			trees[i] = New[int](intHasher)
+			for j := range N {
+				trees[i] = trees[i].Insert(rand.Intn(2*N), j)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for i := range trees {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range trees {
+					if res, expect := trees[i].MergeCached(trees[j], max, cache), trees[i].Merge(trees[j], max); !res.Equal(expect, cmpEq[int]) {
+						t.Error("Expected", res, "to equal", expect)
+					}
+					if res, expect := trees[i].EqualCached(trees[j], cmpEq[int], cache), trees[i].Equal(trees[j], cmpEq[int]); res != expect {
+						t.Errorf("EqualCached = %v, expected %v", res, expect)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("Sets", func(t *testing.T) {
+		cache := NewOpCache[int, struct{}](64)
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			for range 20 {
+				base := NewSet(hasher)
+				for i := range 2 * N {
+					if rand.Intn(2) == 0 {
+						base = base.Insert(i)
+					}
+				}
+				// Derived sets share most of their structure with base
+				a, b := base, base
+				for range 5 {
+					a = a.Insert(rand.Intn(2 * N))
+					b = b.Remove(rand.Intn(2 * N))
+				}
+
+				for range 2 {
+					for _, xy := range [][2]Set[int]{{a, b}, {b, a}, {a, base}} {
+						x, y := xy[0], xy[1]
+						if res, expect := x.UnionCached(y, cache), x.Union(y); !res.Equal(expect) {
+							t.Fatal("Expected", res, "to equal", expect)
+						}
+						if res, expect := x.IntersectCached(y, cache), x.Intersect(y); !res.Equal(expect) {
+							t.Fatal("Expected", res, "to equal", expect)
+						}
+						if res, expect := x.DifferenceCached(y, cache), x.Difference(y); !res.Equal(expect) {
+							t.Fatal("Expected", res, "to equal", expect)
+						}
+						if res, expect := x.IsSubsetCached(y, cache), x.IsSubset(y); res != expect {
+							t.Fatalf("IsSubsetCached = %v, expected %v", res, expect)
+						}
+						if res, expect := x.IntersectionSizeCached(y, cache), x.IntersectionSize(y); res != expect {
+							t.Fatalf("IntersectionSizeCached = %d, expected %d", res, expect)
+						}
+						if res, expect := x.EqualCached(y, cache), x.Equal(y); res != expect {
+							t.Fatalf("EqualCached = %v, expected %v", res, expect)
+						}
+					}
+				}
+			}
+		}
+	})
+}
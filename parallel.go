@@ -0,0 +1,110 @@
+package pmmap
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ParallelOptions configures [Tree.MergeParallel].
+type ParallelOptions struct {
+	// Subtrees are only merged in parallel if their combined size is at least
+	// Threshold. If zero, a default threshold is used.
+	Threshold int
+	// MaxGoroutines limits the number of additional goroutines that are used.
+	// If zero, runtime.GOMAXPROCS(0) is used.
+	MaxGoroutines int
+}
+
+// DefaultParallelThreshold is the threshold used by MergeParallel when the
+// options do not specify one.
+const DefaultParallelThreshold = 1 << 12
+
+// MergeParallel is like Merge, but merges large subtrees in parallel.
+// The result is identical to the result of Merge, including which subtrees are
+// reused from the two maps.
+//
+// `f` may be called concurrently from multiple goroutines.
+func (tree Tree[K, V]) MergeParallel(other Tree[K, V], f MergeFunc[V], opts ParallelOptions) Tree[K, V] {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultParallelThreshold
+	}
+	if opts.MaxGoroutines <= 0 {
+		opts.MaxGoroutines = runtime.GOMAXPROCS(0)
+	}
+
+	m := parallelMerger[K, V]{
+		hasher:    tree.hasher,
+		f:         f,
+		threshold: opts.Threshold,
+		sem:       make(chan struct{}, opts.MaxGoroutines),
+	}
+	tree.root, _ = m.merge(tree.root, other.root)
+	return tree
+}
+
+// parallelMerger holds the state of a parallel merge.
+type parallelMerger[K, V any] struct {
+	hasher    Hasher[K]
+	f         MergeFunc[V]
+	threshold int
+	// Semaphore that bounds the number of additional goroutines
+	sem chan struct{}
+}
+
+// merge two nodes like the sequential merge function.
+func (m *parallelMerger[K, V]) merge(a, b node[K, V]) (node[K, V], bool) {
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok || s == t || s.size+t.size < m.threshold {
+		return merge(a, b, m.hasher, m.f)
+	}
+
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		var (
+			l   node[K, V]
+			leq bool
+			wg  sync.WaitGroup
+		)
+
+		select {
+		case m.sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l, leq = m.merge(s.left, t.left)
+				<-m.sem
+			}()
+		default:
+			// No goroutines available, merge sequentially
+			l, leq = m.merge(s.left, t.left)
+		}
+
+		r, req := m.merge(s.right, t.right)
+		wg.Wait()
+		return mergeBranches(s, t, l, leq, r, req)
+	}
+
+	if s.branchBit > t.branchBit {
+		s, t = t, s
+	}
+
+	if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		l, r := s.left, s.right
+		if zeroBit(t.prefix, s.branchBit) {
+			l, _ = m.merge(l, t)
+			if l == s.left {
+				return s, false
+			}
+		} else {
+			r, _ = m.merge(r, t)
+			if r == s.right {
+				return s, false
+			}
+		}
+		return newBranch(s.prefix, s.branchBit, l, r), false
+	}
+
+	// prefixes disagree
+	return join(s.prefix, t.prefix, s, t), false
+}
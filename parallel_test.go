@@ -0,0 +1,59 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMergeParallel(t *testing.T) {
+	N := 10000
+
+	for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+		a := New[int](hasher)
+		for i := range N {
+			a = a.Insert(i, rand.Int())
+		}
+
+		// b shares most of its structure with a
+		b := a
+		for range N / 10 {
+			k := rand.Intn(2 * N)
+			b = b.Insert(k, rand.Int())
+		}
+		c := New[int](hasher)
+		for i := range N {
+			c = c.Insert(rand.Intn(2*N), i)
+		}
+
+		opts := ParallelOptions{Threshold: 64, MaxGoroutines: 4}
+		for _, pair := range [][2]Tree[int, int]{{a, b}, {b, a}, {a, c}, {a, a}} {
+			x, y := pair[0], pair[1]
+			expect := x.Merge(y, max)
+			got := x.MergeParallel(y, max, opts)
+
+			if !got.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", got, "to equal", expect)
+			}
+			if !sameStructure(got.root, expect.root) {
+				t.Fatal("Expected MergeParallel to reuse the same subtrees as Merge")
+			}
+		}
+	}
+}
+
+// sameStructure checks that two trees are built from the same nodes, except
+// that new branches may be distinct objects.
+func sameStructure[K, V any](a, b node[K, V]) bool {
+	if a == b {
+		return true
+	}
+
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok {
+		// Leaves are reused from the inputs or freshly created by insert
+		return !sok && !tok
+	}
+	return s.prefix == t.prefix && s.branchBit == t.branchBit &&
+		sameStructure(s.left, t.left) && sameStructure(s.right, t.right)
+}
@@ -3,6 +3,7 @@ package pmmap
 import (
 	"fmt"
 	"iter"
+	"math/rand"
 )
 
 // Set represents a persistent hash set backed by a [Tree].
@@ -43,6 +44,39 @@ func (s Set[K]) Union(other Set[K]) Set[K] {
 	return s
 }
 
+// UnionAll returns the union of any number of sets. See [MergeAll] for
+// details. UnionAll panics if no sets are given.
+func UnionAll[K any](sets ...Set[K]) Set[K] {
+	if len(sets) == 0 {
+		panic("pmmap: UnionAll requires at least one set")
+	}
+	trees := make([]Tree[K, struct{}], len(sets))
+	for i, s := range sets {
+		trees[i] = s.m
+	}
+	return Set[K]{MergeAll(func(a, _ struct{}) (struct{}, bool) {
+		return a, true
+	}, trees...)}
+}
+
+// Difference returns the elements of this set that are not in the other set.
+//
+// This operation is made fast by skipping processing of shared subtrees.
+func (s Set[K]) Difference(other Set[K]) Set[K] {
+	s.m = s.m.Difference(other.m)
+	return s
+}
+
+// Intersect returns a set containing the elements present in both sets.
+//
+// Shared subtrees are returned as-is without being traversed.
+func (s Set[K]) Intersect(other Set[K]) Set[K] {
+	s.m = s.m.Intersect(other.m, func(a, _ struct{}) (struct{}, bool) {
+		return a, true
+	})
+	return s
+}
+
 // IntersectionSize returns the number of elements present in both sets.
 //
 // This operation is made fast by skipping processing of shared subtrees.
@@ -54,17 +88,17 @@ func (s Set[K]) IntersectionSize(other Set[K]) int {
 }
 
 // intersectionSize returns the number of keys present in both trees.
-func intersectionSize[K any](a, b node[K, struct{}], hasher Hasher[K]) int {
+func intersectionSize[K, V any](a, b node[K, V], hasher Hasher[K]) int {
 	// Shared subtree — all keys match.
 	if a == b {
 		return nodeSize(a)
 	}
 
 	// Check if either a or b is a leaf.
-	lf, isLeaf := a.(*leaf[K, struct{}])
+	lf, isLeaf := a.(*leaf[K, V])
 	other := b
 	if !isLeaf {
-		lf, isLeaf = b.(*leaf[K, struct{}])
+		lf, isLeaf = b.(*leaf[K, V])
 		other = a
 	}
 
@@ -79,7 +113,7 @@ func intersectionSize[K any](a, b node[K, struct{}], hasher Hasher[K]) int {
 	}
 
 	// Both are branches.
-	s, t := a.(*branch[K, struct{}]), b.(*branch[K, struct{}])
+	s, t := a.(*branch[K, V]), b.(*branch[K, V])
 	if s.branchBit == t.branchBit && s.prefix == t.prefix {
 		return intersectionSize(s.left, t.left, hasher) +
 			intersectionSize(s.right, t.right, hasher)
@@ -109,6 +143,36 @@ func (s Set[K]) Equal(other Set[K]) bool {
 	return s.m.Equal(other.m, func(_, _ struct{}) bool { return true })
 }
 
+// ShareWith returns a set that is equal to this set, but where subtrees that
+// are equal to subtrees of the other set are replaced by references into the
+// other set. See [Tree.ShareWith].
+func (s Set[K]) ShareWith(other Set[K]) Set[K] {
+	s.m = s.m.ShareWith(other.m, func(_, _ struct{}) bool { return true })
+	return s
+}
+
+// IsSubset reports whether every element of this set is also in the other set.
+//
+// This operation is made fast by skipping processing of shared subtrees.
+func (s Set[K]) IsSubset(other Set[K]) bool {
+	return s.m.IsSubmapOf(other.m, func(_, _ struct{}) bool { return true })
+}
+
+// Filter returns a set containing the elements that satisfy `pred`.
+//
+// Subtrees where every element satisfies `pred` are reused from this set.
+func (s Set[K]) Filter(pred func(K) bool) Set[K] {
+	s.m = s.m.Filter(func(k K, _ struct{}) bool { return pred(k) })
+	return s
+}
+
+// Partition splits the set into two sets: one containing the elements that
+// satisfy `pred`, and one containing the elements that do not.
+func (s Set[K]) Partition(pred func(K) bool) (in, out Set[K]) {
+	in.m, out.m = s.m.Partition(func(k K, _ struct{}) bool { return pred(k) })
+	return
+}
+
 // All returns an iterator over all keys in the set.
 func (s Set[K]) All() iter.Seq[K] {
 	return s.m.Keys()
@@ -119,6 +183,26 @@ func (s Set[K]) Size() int {
 	return s.m.Size()
 }
 
+// At returns the element at position i in the iteration order of the set.
+// It panics if i is out of range.
+func (s Set[K]) At(i int) K {
+	k, _ := s.m.At(i)
+	return k
+}
+
+// Rank returns the position of the given key in the iteration order of the
+// set, or -1 if the key is not in the set.
+func (s Set[K]) Rank(key K) int {
+	return s.m.Rank(key)
+}
+
+// Sample returns a uniformly random element from the set, using the provided
+// source of randomness. It panics if the set is empty.
+func (s Set[K]) Sample(rng *rand.Rand) K {
+	k, _ := s.m.Sample(rng)
+	return k
+}
+
 func (s Set[K]) String() string {
 	buf := make([]string, 0, s.Size())
 	for k := range s.All() {
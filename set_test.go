@@ -108,3 +108,154 @@ func TestSetIntersectionSizeMany(t *testing.T) {
 		}
 	}
 }
+
+func TestSetDifference(t *testing.T) {
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(5)} {
+		t.Run(fmt.Sprintf("%T", hasher), func(t *testing.T) {
+			empty := NewSet[int](hasher)
+			a := empty.Insert(1).Insert(2).Insert(3).Insert(4)
+			b := empty.Insert(3).Insert(4).Insert(5)
+
+			if d := a.Difference(b); !d.Equal(empty.Insert(1).Insert(2)) {
+				t.Errorf("expected set[1 2], got %v", d)
+			}
+			if d := b.Difference(a); !d.Equal(empty.Insert(5)) {
+				t.Errorf("expected set[5], got %v", d)
+			}
+			if d := a.Difference(a); d.Size() != 0 {
+				t.Errorf("expected empty set, got %v", d)
+			}
+			if d := a.Difference(empty); d.m.root != a.m.root {
+				t.Errorf("expected %v to be reused", a)
+			}
+		})
+	}
+}
+
+func TestSetIsSubset(t *testing.T) {
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(5)} {
+		t.Run(fmt.Sprintf("%T", hasher), func(t *testing.T) {
+			empty := NewSet[int](hasher)
+			a := empty.Insert(1).Insert(2).Insert(3).Insert(4)
+			b := empty.Insert(2).Insert(4)
+
+			if !empty.IsSubset(a) {
+				t.Error("expected empty set to be a subset")
+			}
+			if !b.IsSubset(a) {
+				t.Errorf("expected %v to be a subset of %v", b, a)
+			}
+			if a.IsSubset(b) {
+				t.Errorf("expected %v not to be a subset of %v", a, b)
+			}
+			if b.Insert(5).IsSubset(a) {
+				t.Errorf("expected %v not to be a subset of %v", b.Insert(5), a)
+			}
+			if !a.IsSubset(a) {
+				t.Errorf("expected %v to be a subset of itself", a)
+			}
+		})
+	}
+}
+
+func TestSetPartition(t *testing.T) {
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(5)} {
+		t.Run(fmt.Sprintf("%T", hasher), func(t *testing.T) {
+			empty := NewSet[int](hasher)
+			s := empty.Insert(1).Insert(2).Insert(3).Insert(4)
+			even := func(k int) bool { return k%2 == 0 }
+
+			in, out := s.Partition(even)
+			if !in.Equal(empty.Insert(2).Insert(4)) {
+				t.Errorf("expected set[2 4], got %v", in)
+			}
+			if !out.Equal(empty.Insert(1).Insert(3)) {
+				t.Errorf("expected set[1 3], got %v", out)
+			}
+			if f := s.Filter(even); !f.Equal(in) {
+				t.Errorf("expected %v, got %v", in, f)
+			}
+		})
+	}
+}
+
+func TestSetPositional(t *testing.T) {
+	s := NewSet(intHasher).Insert(1).Insert(2).Insert(3)
+	for i := range s.Size() {
+		if r := s.Rank(s.At(i)); r != i {
+			t.Errorf("Rank(At(%d)) = %d", i, r)
+		}
+	}
+	if r := s.Rank(4); r != -1 {
+		t.Errorf("Rank(4) = %d, expected -1", r)
+	}
+	if k := s.Sample(rand.New(rand.NewSource(0))); !s.Contains(k) {
+		t.Errorf("Sample() = %d is not in %v", k, s)
+	}
+}
+
+func TestSetUnionAll(t *testing.T) {
+	empty := NewSet(intHasher)
+	a := empty.Insert(1).Insert(2)
+	b := empty.Insert(2).Insert(3)
+	c := empty.Insert(4)
+
+	if u := UnionAll(a, b, a, c, empty); !u.Equal(empty.Insert(1).Insert(2).Insert(3).Insert(4)) {
+		t.Errorf("expected set[1 2 3 4], got %v", u)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected UnionAll to panic")
+		}
+	}()
+	UnionAll[int]()
+}
+
+func TestSetHasher(t *testing.T) {
+	empty := NewSet(intHasher)
+	powerset := NewSet(Hasher[Set[int]](SetHasher[int]{}))
+	for i := range 1 << 4 {
+		s := empty
+		for j := range 4 {
+			if i&(1<<j) != 0 {
+				s = s.Insert(j)
+			}
+		}
+		powerset = powerset.Insert(s)
+	}
+
+	if n := powerset.Size(); n != 1<<4 {
+		t.Fatalf("Expected %d subsets, got %d", 1<<4, n)
+	}
+	if s := empty.Insert(3).Insert(1); !powerset.Contains(s) {
+		t.Errorf("Expected %v to contain %v", powerset, s)
+	}
+	if powerset.Contains(empty.Insert(4)) {
+		t.Errorf("Expected %v to not contain set[4]", powerset)
+	}
+}
+
+func TestSetShareWith(t *testing.T) {
+	a, b := NewSet(intHasher), NewSet(intHasher)
+	for i := range 100 {
+		a, b = a.Insert(i), b.Insert(99-i)
+	}
+
+	if s := a.ShareWith(b); s.m.root != b.m.root {
+		t.Errorf("Expected %p to be %p", s.m.root, b.m.root)
+	}
+}
+
+func TestSetIntersect(t *testing.T) {
+	empty := NewSet(intHasher)
+	a := empty.Insert(1).Insert(2).Insert(3)
+	b := empty.Insert(2).Insert(3).Insert(4)
+
+	if s := a.Intersect(b); !s.Equal(empty.Insert(2).Insert(3)) {
+		t.Errorf("expected set[2 3], got %v", s)
+	}
+	if s := a.Intersect(a); s.m.root != a.m.root {
+		t.Errorf("Expected %p to be %p", s.m.root, a.m.root)
+	}
+}
@@ -0,0 +1,153 @@
+package pmmap
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// HashRange returns the map restricted to the keys whose hash (as computed by
+// the map's hasher) lies in the inclusive range [lo, hi].
+//
+// Subtrees that lie entirely within the range are reused, so this operation
+// takes time proportional to the depth of the tree.
+func (tree Tree[K, V]) HashRange(lo, hi uint64) Tree[K, V] {
+	if lo > hi {
+		tree.root = nil
+	} else {
+		tree.root = hashRange(tree.root, lo, hi)
+	}
+	return tree
+}
+
+// Split cuts the map into n disjoint shards that cover consecutive ranges of
+// key hashes. The shards have roughly equal sizes, except that keys with
+// equal hashes always end up in the same shard. Some shards may be empty.
+//
+// The shards reuse the subtrees of the map, and are computed in O(n·depth)
+// time. They can be joined back together with [Concat].
+func (tree Tree[K, V]) Split(n int) []Tree[K, V] {
+	if n < 1 {
+		panic("pmmap: Split requires a positive number of shards")
+	}
+
+	// bounds[i] is the lowest hash in shard i
+	size := tree.Size()
+	bounds := make([]uint64, n)
+	for i := 1; i < n; i++ {
+		if rank := i * size / n; rank < size {
+			lf, _ := leafAt(tree.root, rank)
+			bounds[i] = bits.Reverse64(lf.key)
+		} else {
+			bounds[i] = math.MaxUint64
+		}
+	}
+
+	shards := make([]Tree[K, V], n)
+	for i := range shards {
+		switch {
+		case i+1 == n:
+			shards[i] = tree.HashRange(bounds[i], math.MaxUint64)
+		case bounds[i] == bounds[i+1]:
+			shards[i] = Tree[K, V]{tree.hasher, nil}
+		default:
+			shards[i] = tree.HashRange(bounds[i], bounds[i+1]-1)
+		}
+	}
+	return shards
+}
+
+// Concat joins maps with disjoint keys, such as the shards returned by
+// [Tree.Split], into a single map.
+//
+// The maps are joined structurally with join, so only the paths where their
+// hash ranges meet are traversed. Equal keys have equal hashes, so every key
+// that occurs in more than one of the maps is on such a path, and Concat
+// panics if it finds one. Concat also panics if no maps are given.
+func Concat[K, V any](shards ...Tree[K, V]) Tree[K, V] {
+	if len(shards) == 0 {
+		panic("pmmap: Concat requires at least one map")
+	}
+	tree := shards[0]
+	for _, shard := range shards[1:] {
+		tree.root = concat(tree.root, shard.root, tree.hasher)
+	}
+	return tree
+}
+
+// concat joins two nodes with disjoint keys.
+func concat[K, V any](a, b node[K, V], hasher Hasher[K]) node[K, V] {
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	} else if a == b {
+		panic("pmmap: Concat of maps with overlapping keys")
+	}
+
+	if s, ok := a.(*leaf[K, V]); ok {
+		if t, ok := b.(*leaf[K, V]); ok && s.key == t.key {
+			// Keys with colliding hashes
+			values := slices.Clone(s.values)
+			for _, pr := range t.values {
+				if _, found := lookup[K, V](s, s.key, pr.key, hasher); found {
+					panic("pmmap: Concat of maps with overlapping keys")
+				}
+				values = slices.Insert(values, bucketIndex(values, pr.key, hasher), pr)
+			}
+			return mkLeaf(s.key, values)
+		}
+	}
+
+	pa, pb := prefixOf(a), prefixOf(b)
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	switch {
+	case sok && tok && s.branchBit == t.branchBit && s.prefix == t.prefix:
+		return newBranch(s.prefix, s.branchBit, concat(s.left, t.left, hasher), concat(s.right, t.right, hasher))
+	case sok && s.match(pb) && (!tok || s.branchBit < t.branchBit):
+		// s contains b
+		if zeroBit(pb, s.branchBit) {
+			return newBranch(s.prefix, s.branchBit, concat(s.left, b, hasher), s.right)
+		}
+		return newBranch(s.prefix, s.branchBit, s.left, concat(s.right, b, hasher))
+	case tok && t.match(pa) && (!sok || t.branchBit < s.branchBit):
+		// t contains a
+		if zeroBit(pa, t.branchBit) {
+			return newBranch(t.prefix, t.branchBit, concat(a, t.left, hasher), t.right)
+		}
+		return newBranch(t.prefix, t.branchBit, t.left, concat(a, t.right, hasher))
+	default:
+		// prefixes disagree
+		return join(pa, pb, a, b)
+	}
+}
+
+// hashRange restricts the subtree rooted at n to the keys whose (non-reversed)
+// hashes lie in [lo, hi].
+func hashRange[K, V any](n node[K, V], lo, hi uint64) node[K, V] {
+	// Compute the range of hashes covered by the subtree
+	var first, last uint64
+	switch nd := n.(type) {
+	case nil:
+		return nil
+	case *leaf[K, V]:
+		first = bits.Reverse64(nd.key)
+		last = first
+	case *branch[K, V]:
+		first = bits.Reverse64(nd.prefix)
+		last = bits.Reverse64(nd.prefix | ^(nd.branchBit - 1))
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	if last < lo || hi < first {
+		return nil
+	} else if lo <= first && last <= hi {
+		return n
+	}
+
+	b := n.(*branch[K, V])
+	l, r := hashRange(b.left, lo, hi), hashRange(b.right, lo, hi)
+	return br(b.prefix, b.branchBit, l, r)
+}
@@ -0,0 +1,115 @@
+package pmmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		tree := New[int](hasher)
+		for range N {
+			k := rand.Int()
+			tree = tree.Insert(k, k)
+		}
+
+		for _, n := range []int{1, 2, 3, 7, N, 2 * N} {
+			shards := tree.Split(n)
+			if len(shards) != n {
+				t.Fatalf("Split(%d) returned %d shards", n, len(shards))
+			}
+
+			total := 0
+			var prev uint64
+			for i, shard := range shards {
+				total += shard.Size()
+				for k := range shard.Keys() {
+					// Shards cover consecutive hash ranges
+					if h := hasher.Hash(k); h < prev {
+						t.Fatalf("Shard %d contains hash %d after %d", i, h, prev)
+					} else {
+						prev = h
+					}
+				}
+			}
+			if total != N {
+				t.Fatalf("Split(%d) shards contain %d keys, expected %d", n, total, N)
+			}
+
+			if _, spread := hasher.(NumericHasher[int]); spread && n <= N {
+				for i, shard := range shards {
+					if sz := shard.Size(); sz < N/n-N/10 || sz > N/n+N/10 {
+						t.Errorf("Split(%d) shard %d has unbalanced size %d", n, i, sz)
+					}
+				}
+			}
+
+			joined := Concat(shards...)
+			if !joined.Equal(tree, cmpEq[int]) {
+				t.Fatal("Expected", joined, "to equal", tree)
+			}
+		}
+	}
+
+	t.Run("HashRange", func(t *testing.T) {
+		tree := New[int](intHasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		for range N {
+			lo, hi := rand.Intn(N+10), rand.Intn(N+10)
+			sub := tree.HashRange(uint64(lo), uint64(hi))
+			expect := 0
+			for i := range N {
+				if _, found := sub.Lookup(i); found != (lo <= i && i <= hi) {
+					t.Fatalf("HashRange(%d, %d) contains %d: %v", lo, hi, i, found)
+				} else if found {
+					expect++
+				}
+			}
+			if sz := sub.Size(); sz != expect {
+				t.Fatalf("HashRange(%d, %d) has size %d, expected %d", lo, hi, sz, expect)
+			}
+		}
+
+		// The root covers all hashes below 128
+		if sub := tree.HashRange(0, 127); sub.root != tree.root {
+			t.Errorf("Expected %p to be %p", sub.root, tree.root)
+		}
+	})
+	t.Run("ConcatOverlap", func(t *testing.T) {
+		tree := New[int](intHasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		for _, shards := range [][]Tree[int, int]{
+			{tree, tree},
+			{tree.HashRange(0, 50), tree.HashRange(50, 127)},
+			{New[int](intHasher).Insert(3, 0), tree.HashRange(0, 10)},
+			{},
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("Expected Concat of %v to panic", shards)
+					}
+				}()
+				Concat(shards...)
+			}()
+		}
+	})
+
+	t.Run("ConcatCollisions", func(t *testing.T) {
+		// Keys with equal hashes in different maps are joined in one leaf
+		a := New[int](collidingHasher{}).Insert(0, 0).Insert(1, 1)
+		b := New[int](collidingHasher{}).Insert(3, 3).Insert(4, 4)
+		expect := a.Insert(3, 3).Insert(4, 4)
+		if res := Concat(a, b); !res.Equal(expect, cmpEq[int]) || res.String() != expect.String() {
+			t.Fatal("Expected", res, "to equal", expect)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package pmmap
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+)
+
+// sortBufferSize is the number of pairs buffered by the first pass of
+// AllSorted.
+const sortBufferSize = 1 << 10
+
+// AllSorted returns an iterator over all key-value pairs in the map, in the
+// key order given by `cmp`. `cmp` must be consistent with the map's hasher.
+//
+// The pairs are streamed through a bounded buffer: every pass over the map
+// selects the next pairs in key order with a heap. The first pass selects (at
+// most) 1024 pairs, and every later pass selects twice as many as the previous
+// one. Stopping the iteration after k pairs therefore takes O(log(k/1024 + 1))
+// passes over the map, iterating over all pairs takes O(n log n) time, and the
+// buffer never holds more than about twice the number of yielded pairs.
+func (tree Tree[K, V]) AllSorted(cmp func(a, b K) int) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		total := tree.Size()
+		h := pairHeap[K, V]{cmp: cmp}
+		var last K
+		for yielded, size := 0, sortBufferSize; yielded < total; size *= 2 {
+			h.pairs = make([]pair[K, V], 0, min(size, total-yielded))
+			for k, v := range tree.All() {
+				if yielded > 0 && cmp(k, last) <= 0 {
+					// Yielded in a previous pass
+					continue
+				}
+				h.offer(pair[K, V]{k, v})
+			}
+
+			n := len(h.pairs)
+			for _, pr := range h.sort() {
+				if !yield(pr.key, pr.value) {
+					return
+				}
+			}
+			if n < size {
+				// The pass found fewer pairs than fit in the buffer
+				return
+			}
+
+			yielded += n
+			last = h.pairs[n-1].key
+		}
+	}
+}
+
+// AllSorted returns an iterator over all keys in the set, in the order given
+// by `cmp`. See [Tree.AllSorted] for details.
+func (s Set[K]) AllSorted(cmp func(a, b K) int) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range s.m.AllSorted(cmp) {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Sorted returns an iterator over all key-value pairs in the map in ascending
+// key order.
+func Sorted[K cmp.Ordered, V any](tree Tree[K, V]) iter.Seq2[K, V] {
+	return tree.AllSorted(cmp.Compare[K])
+}
+
+// SortedSet returns an iterator over all keys in the set in ascending order.
+func SortedSet[K cmp.Ordered](s Set[K]) iter.Seq[K] {
+	return s.AllSorted(cmp.Compare[K])
+}
+
+// SortedString is like String, but the key-value pairs are listed in the key
+// order given by `cmp`. The output only depends on the contents of the map.
+func (tree Tree[K, V]) SortedString(cmp func(a, b K) int) string {
+	buf := make([]string, 0, tree.Size())
+	for k, v := range tree.AllSorted(cmp) {
+		buf = append(buf, fmt.Sprintf("%v ↦ %v", k, v))
+	}
+	return fmt.Sprintf("tree%s", buf)
+}
+
+// SortedString is like String, but the elements are listed in the order given
+// by `cmp`. The output only depends on the contents of the set.
+func (s Set[K]) SortedString(cmp func(a, b K) int) string {
+	buf := make([]string, 0, s.Size())
+	for k := range s.AllSorted(cmp) {
+		buf = append(buf, fmt.Sprintf("%v", k))
+	}
+	return fmt.Sprintf("set%s", buf)
+}
+
+// pairHeap is a bounded binary max-heap of key-value pairs ordered by key,
+// which retains the pairs with the smallest keys.
+type pairHeap[K, V any] struct {
+	cmp   func(a, b K) int
+	pairs []pair[K, V] // The capacity of the slice bounds the heap
+}
+
+// offer adds the pair to the heap, evicting the pair with the largest key if
+// the heap is full.
+func (h *pairHeap[K, V]) offer(pr pair[K, V]) {
+	if len(h.pairs) < cap(h.pairs) {
+		h.pairs = append(h.pairs, pr)
+		h.up(len(h.pairs) - 1)
+	} else if len(h.pairs) > 0 && h.cmp(pr.key, h.pairs[0].key) < 0 {
+		h.pairs[0] = pr
+		h.down(0, len(h.pairs))
+	}
+}
+
+// sort sorts the pairs in ascending key order in-place and returns them. The
+// heap invariant is destroyed.
+func (h *pairHeap[K, V]) sort() []pair[K, V] {
+	for end := len(h.pairs) - 1; end > 0; end-- {
+		h.pairs[0], h.pairs[end] = h.pairs[end], h.pairs[0]
+		h.down(0, end)
+	}
+	return h.pairs
+}
+
+func (h *pairHeap[K, V]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h.cmp(h.pairs[i].key, h.pairs[parent].key) <= 0 {
+			return
+		}
+
+		h.pairs[i], h.pairs[parent] = h.pairs[parent], h.pairs[i]
+		i = parent
+	}
+}
+
+// down restores the heap invariant below i in the first n pairs.
+func (h *pairHeap[K, V]) down(i, n int) {
+	for {
+		largest := i
+		if l := 2*i + 1; l < n && h.cmp(h.pairs[l].key, h.pairs[largest].key) > 0 {
+			largest = l
+		}
+		if r := 2*i + 2; r < n && h.cmp(h.pairs[r].key, h.pairs[largest].key) > 0 {
+			largest = r
+		}
+		if largest == i {
+			return
+		}
+
+		h.pairs[i], h.pairs[largest] = h.pairs[largest], h.pairs[i]
+		i = largest
+	}
+}
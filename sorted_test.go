@@ -0,0 +1,119 @@
+package pmmap
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestAllSorted(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		tree := New[int](hasher)
+		set := NewSet(hasher)
+		keys := rand.Perm(N)
+		for _, k := range keys {
+			tree = tree.Insert(k, -k)
+			set = set.Insert(k)
+		}
+
+		slices.Sort(keys)
+		var got []int
+		for k, v := range Sorted(tree) {
+			if v != -k {
+				t.Fatalf("Sorted yielded (%d, %d)", k, v)
+			}
+			got = append(got, k)
+		}
+		if !slices.Equal(got, keys) {
+			t.Fatalf("Expected %v, got %v", keys, got)
+		}
+
+		if got := slices.Collect(SortedSet(set)); !slices.Equal(got, keys) {
+			t.Fatalf("Expected %v, got %v", keys, got)
+		}
+
+		desc := func(a, b int) int { return cmp.Compare(b, a) }
+		slices.Reverse(keys)
+		if got := slices.Collect(set.AllSorted(desc)); !slices.Equal(got, keys) {
+			t.Fatalf("Expected %v, got %v", keys, got)
+		}
+	}
+
+	t.Run("MultiplePasses", func(t *testing.T) {
+		// More pairs than fit in the buffer of a single pass
+		n := 3*sortBufferSize + 7
+		tree := New[int](mkMemHasher(n / 5))
+		for _, k := range rand.Perm(n) {
+			tree = tree.Insert(k, -k)
+		}
+
+		i := 0
+		for k, v := range Sorted(tree) {
+			if k != i || v != -k {
+				t.Fatalf("Expected (%d, %d), got (%d, %d)", i, -i, k, v)
+			}
+			i++
+		}
+		if i != n {
+			t.Fatalf("Expected %d pairs, got %d", n, i)
+		}
+	})
+
+	t.Run("EarlyTermination", func(t *testing.T) {
+		tree := New[int](intHasher)
+		for i := range N {
+			tree = tree.Insert(N-i, i)
+		}
+
+		count := 0
+		for k := range Sorted(tree) {
+			count++
+			if k != count {
+				t.Fatalf("Expected key %d, got %d", count, k)
+			}
+			if count == 3 {
+				break
+			}
+		}
+		if count != 3 {
+			t.Fatalf("expected 3 iterations, got %d", count)
+		}
+	})
+
+	t.Run("NoExtraPass", func(t *testing.T) {
+		for _, n := range []int{N, sortBufferSize, 3*sortBufferSize + 7} {
+			tree := New[int](intHasher)
+			for i := range n {
+				tree = tree.Insert(i, i)
+			}
+
+			// Count the comparisons made after the last pair was yielded
+			calls := 0
+			count := func(a, b int) int {
+				calls++
+				return cmp.Compare(a, b)
+			}
+			for range tree.AllSorted(count) {
+				calls = 0
+			}
+			if calls != 0 {
+				t.Errorf("Expected no comparisons after the last pair of %d, got %d", n, calls)
+			}
+		}
+	})
+}
+
+func ExampleTree_SortedString() {
+	hasher := NumericHasher[int]{}
+	tree := New[string](hasher).Insert(3, "c").Insert(1, "a").Insert(2, "b")
+	fmt.Println(tree.SortedString(cmp.Compare[int]))
+	fmt.Println(tree.KeySet().SortedString(cmp.Compare[int]))
+
+	// Output:
+	// tree[1 ↦ a 2 ↦ b 3 ↦ c]
+	// set[1 2 3]
+}
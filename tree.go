@@ -13,7 +13,9 @@ import (
 	"fmt"
 	"iter"
 	"math/bits"
+	"math/rand"
 	"slices"
+	"sync/atomic"
 )
 
 // Construct a new persistent key-value map with the specified hasher.
@@ -64,6 +66,31 @@ func (tree Tree[K, V]) InsertOrMerge(key K, value V, f MergeFunc[V]) Tree[K, V]
 	return tree
 }
 
+// Alter inserts, updates or removes the mapping for the given key in a single
+// traversal of the map. `f` is called with the previous value for the key and
+// whether it exists. If the second result of `f` is false, the key is removed
+// from the map, otherwise it is mapped to the first result.
+//
+// The returned flag reports whether the map changed. If it is false, the
+// returned map is (reference-)equal to the receiver. Values cannot be compared,
+// so keeping an existing key always counts as a change; use AlterFunc to
+// detect updates that leave the value unchanged.
+func (tree Tree[K, V]) Alter(key K, f func(old V, found bool) (V, bool)) (Tree[K, V], bool) {
+	return tree.AlterFunc(key, func(old V, found bool) (V, bool, bool) {
+		value, keep := f(old, found)
+		return value, keep, true
+	})
+}
+
+// AlterFunc is like Alter, but when `f` keeps an existing key, its third
+// result reports whether the value changed. If it did not, the map is returned
+// unchanged. The third result is ignored for keys that do not exist.
+func (tree Tree[K, V]) AlterFunc(key K, f func(old V, found bool) (value V, keep, changed bool)) (Tree[K, V], bool) {
+	var changed bool
+	tree.root, changed = alter(tree.root, tree.hash(key), key, tree.hasher, f)
+	return tree, changed
+}
+
 // Remove a mapping for the given key if it exists.
 func (tree Tree[K, V]) Remove(key K) Tree[K, V] {
 	tree.root = remove(tree.root, tree.hash(key), key, tree.hasher)
@@ -114,17 +141,209 @@ func (tree Tree[K, V]) Merge(other Tree[K, V], f MergeFunc[V]) Tree[K, V] {
 	return tree
 }
 
+// MergeAll merges any number of maps. See [Tree.Merge] for details.
+//
+// Maps with identical roots are merged only once, and the remaining maps are
+// merged pairwise in a balanced order. MergeAll panics if no maps are given.
+func MergeAll[K, V any](f MergeFunc[V], trees ...Tree[K, V]) Tree[K, V] {
+	if len(trees) == 0 {
+		panic("pmmap: MergeAll requires at least one map")
+	}
+	res := trees[0]
+
+	seen := make(map[node[K, V]]bool, len(trees))
+	roots := make([]node[K, V], 0, len(trees))
+	for _, tree := range trees {
+		if tree.root != nil && !seen[tree.root] {
+			seen[tree.root] = true
+			roots = append(roots, tree.root)
+		}
+	}
+
+	for len(roots) > 1 {
+		next := roots[:0]
+		for i := 0; i < len(roots); i += 2 {
+			if i+1 == len(roots) {
+				next = append(next, roots[i])
+			} else {
+				n, _ := merge(roots[i], roots[i+1], res.hasher, f)
+				next = append(next, n)
+			}
+		}
+		roots = next
+	}
+
+	res.root = nil
+	if len(roots) == 1 {
+		res.root = roots[0]
+	}
+	return res
+}
+
+// Intersect returns a map containing the keys that are present in both maps.
+// Each key is mapped to the result of `f` on the two values.
+//
+// See the documentation for MergeFunc for conditions that `f` must satisfy.
+// Shared subtrees are returned as-is without being traversed.
+func (tree Tree[K, V]) Intersect(other Tree[K, V], f MergeFunc[V]) Tree[K, V] {
+	tree.root = intersect(tree.root, other.root, tree.hasher, f)
+	return tree
+}
+
+// Intersect returns a map containing the keys that are present in both a and
+// b, whose values may have different types. Each key k is mapped to the first
+// result of `f(k, va, vb)`, unless the second result is false, in which case
+// the key is left out of the result.
+//
+// Subtrees of a and b that cover disjoint hash prefixes are skipped.
+// The resulting map uses the hasher of a.
+func Intersect[K, A, B, C any](a Tree[K, A], b Tree[K, B], f func(K, A, B) (C, bool)) Tree[K, C] {
+	return Tree[K, C]{a.hasher, intersectWith(a.root, b.root, a.hasher, f)}
+}
+
+// Difference returns a map containing the key-value pairs of this map whose
+// keys are not present in the other map.
+//
+// Subtrees that are shared between the maps are dropped without being
+// traversed, and subtrees without a counterpart in the other map are kept.
+func (tree Tree[K, V]) Difference(other Tree[K, V]) Tree[K, V] {
+	tree.root = difference(tree.root, other.root, tree.hasher)
+	return tree
+}
+
+// Difference returns a map containing the key-value pairs of a whose keys are
+// not present in b, whose values may have a different type.
+//
+// Subtrees of a without a counterpart in b are kept without being traversed.
+// The resulting map uses the hasher of a.
+func Difference[K, A, B any](a Tree[K, A], b Tree[K, B]) Tree[K, A] {
+	a.root = difference(a.root, b.root, a.hasher)
+	return a
+}
+
+// Without returns a map containing the key-value pairs of this map whose keys
+// are not present in the given set.
+func (tree Tree[K, V]) Without(keys Set[K]) Tree[K, V] {
+	tree.root = difference(tree.root, keys.m.root, tree.hasher)
+	return tree
+}
+
+// Filter returns a map containing the key-value pairs that satisfy `pred`.
+//
+// Subtrees where every pair satisfies `pred` are reused from this map.
+func (tree Tree[K, V]) Filter(pred func(K, V) bool) Tree[K, V] {
+	tree.root, _ = partition(tree.root, pred)
+	return tree
+}
+
+// Partition splits the map into two maps: one containing the key-value pairs
+// that satisfy `pred`, and one containing the pairs that do not.
+//
+// Subtrees that end up entirely on one side are reused from this map.
+func (tree Tree[K, V]) Partition(pred func(K, V) bool) (in, out Tree[K, V]) {
+	in, out = tree, tree
+	in.root, out.root = partition(tree.root, pred)
+	return
+}
+
+// MapValues returns a map with the same keys as t, where each key k is
+// mapped to `f(k, v)`.
+//
+// The shape of the trie is copied node for node, so no keys are rehashed.
+func MapValues[K, V, W any](t Tree[K, V], f func(K, V) W) Tree[K, W] {
+	return Tree[K, W]{t.hasher, mapValues(t.root, f)}
+}
+
+// KeySet returns the set of keys in the map. The set uses the same hasher as
+// the map.
+func (tree Tree[K, V]) KeySet() Set[K] {
+	return Set[K]{MapValues(tree, func(K, V) struct{} { return struct{}{} })}
+}
+
 // Equal checks whether two maps are equal. Values are compared with the provided
 // function. This operation also skips processing of shared subtrees.
 func (tree Tree[K, V]) Equal(other Tree[K, V], f func(V, V) bool) bool {
 	return equal(tree.root, other.root, tree.hasher, f)
 }
 
+// ShareWith returns a map that is equal to this map, but where subtrees that
+// are equal to subtrees of the other map are replaced by references into the
+// other map. Values are compared with `eq`.
+//
+// This restores structural sharing between maps that were constructed
+// independently, which speeds up subsequent operations between them.
+func (tree Tree[K, V]) ShareWith(other Tree[K, V], eq func(V, V) bool) Tree[K, V] {
+	tree.root = share(tree.root, other.root, tree.hasher, eq)
+	return tree
+}
+
+// IsSubmapOf reports whether every key in this map is also present in the
+// other map, with values related by `leq`. The first argument to `leq` is the
+// value from this map.
+//
+// Shared subtrees are skipped, and the check stops at the first key that is
+// missing or fails the predicate.
+func (tree Tree[K, V]) IsSubmapOf(other Tree[K, V], leq func(a, b V) bool) bool {
+	return isSubmap(tree.root, other.root, tree.hasher, leq)
+}
+
 // Size returns the number of key-value pairs in the map.
 func (tree Tree[K, V]) Size() int {
 	return nodeSize(tree.root)
 }
 
+// At returns the key-value pair at position i in the iteration order of the
+// map (see [Tree.All]). It panics if i is out of range.
+//
+// This operation takes time proportional to the depth of the tree.
+func (tree Tree[K, V]) At(i int) (K, V) {
+	if i < 0 || i >= tree.Size() {
+		panic(fmt.Sprintf("pmmap: index %d out of range [0:%d]", i, tree.Size()))
+	}
+
+	lf, i := leafAt(tree.root, i)
+	return lf.values[i].key, lf.values[i].value
+}
+
+// Rank returns the position of the given key in the iteration order of the
+// map (see [Tree.All]), or -1 if the key is not in the map.
+func (tree Tree[K, V]) Rank(key K) int {
+	hash := tree.hash(key)
+	rank, n := 0, tree.root
+	for {
+		switch nd := n.(type) {
+		case nil:
+			return -1
+		case *leaf[K, V]:
+			if nd.key == hash {
+				for i, pr := range nd.values {
+					if tree.hasher.Equal(key, pr.key) {
+						return rank + i
+					}
+				}
+			}
+			return -1
+		case *branch[K, V]:
+			if !nd.match(hash) {
+				return -1
+			} else if zeroBit(hash, nd.branchBit) {
+				n = nd.left
+			} else {
+				rank += nodeSize(nd.left)
+				n = nd.right
+			}
+		default:
+			panic("unreachable: unexpected node type")
+		}
+	}
+}
+
+// Sample returns a uniformly random key-value pair from the map, using the
+// provided source of randomness. It panics if the map is empty.
+func (tree Tree[K, V]) Sample(rng *rand.Rand) (K, V) {
+	return tree.At(rng.Intn(tree.Size()))
+}
+
 func (tree Tree[K, V]) String() string {
 	buf := make([]string, 0, tree.Size())
 	for k, v := range tree.All() {
@@ -165,6 +384,10 @@ type (
 		branchBit   keyt
 		left, right node[K, V]
 		size        int
+		// Cached content hash of the subtree, if computed.
+		chash atomic.Pointer[hashCache]
+		// The Builder that may mutate this node in-place, if any.
+		edit *editToken
 	}
 	// pair encodes a key-value pair in leaves.
 	pair[K, V any] struct {
@@ -179,6 +402,10 @@ type (
 		// TODO: Since collisions should be rare it might be worth
 		// it to have a fast implementation when no collisions occur.
 		values []pair[K, V]
+		// Cached content hash of the leaf, if computed.
+		chash atomic.Pointer[hashCache]
+		// The Builder that may mutate this leaf in-place, if any.
+		edit *editToken
 	}
 )
 
@@ -207,7 +434,7 @@ func nodeSize[K, V any](n node[K, V]) int {
 
 // copy constructs a new leaf that inherits the values of this leaf.
 func (l *leaf[K, V]) copy() *leaf[K, V] {
-	return &leaf[K, V]{l.key, slices.Clone(l.values)}
+	return &leaf[K, V]{key: l.key, values: slices.Clone(l.values)}
 }
 
 // iter yields all key-value pairs in the leaf, returning false if iteration was stopped early.
@@ -220,6 +447,20 @@ func (l *leaf[K, V]) iter(yield func(K, V) bool) bool {
 	return true
 }
 
+// bucketIndex returns the position in a leaf's list of values where a new
+// key should be added. If the hasher is a CanonicalHasher the list is kept
+// sorted, otherwise the key is added at the end.
+func bucketIndex[K, V any](values []pair[K, V], key K, hasher Hasher[K]) int {
+	if ch, ok := hasher.(CanonicalHasher[K]); ok {
+		for i, pr := range values {
+			if ch.Compare(key, pr.key) < 0 {
+				return i
+			}
+		}
+	}
+	return len(values)
+}
+
 // lookup searches for key (with precomputed hash) in the subtree rooted at node.
 func lookup[K, V any](node node[K, V], hash keyt, key K, hasher Hasher[K]) (ret V, found bool) {
 	for {
@@ -247,6 +488,36 @@ func lookup[K, V any](node node[K, V], hash keyt, key K, hasher Hasher[K]) (ret
 	}
 }
 
+// newBranch constructs a branch node with the given (non-nil) subtrees.
+func newBranch[K, V any](prefix, branchBit keyt, left, right node[K, V]) *branch[K, V] {
+	return &branch[K, V]{
+		prefix:    prefix,
+		branchBit: branchBit,
+		left:      left,
+		right:     right,
+		size:      nodeSize(left) + nodeSize(right),
+	}
+}
+
+// leafAt returns the leaf containing the i'th key-value pair in the subtree
+// rooted at n, along with the position of the pair in the leaf's bucket.
+func leafAt[K, V any](n node[K, V], i int) (*leaf[K, V], int) {
+	for {
+		switch nd := n.(type) {
+		case *leaf[K, V]:
+			return nd, i
+		case *branch[K, V]:
+			if sz := nodeSize(nd.left); i < sz {
+				n = nd.left
+			} else {
+				n, i = nd.right, i-sz
+			}
+		default:
+			panic("unreachable: unexpected node type")
+		}
+	}
+}
+
 // Smart branch constructor
 func br[K, V any](prefix, branchBit keyt, left, right node[K, V]) node[K, V] {
 	if left == nil {
@@ -255,19 +526,27 @@ func br[K, V any](prefix, branchBit keyt, left, right node[K, V]) node[K, V] {
 		return left
 	}
 
-	return &branch[K, V]{prefix, branchBit, left, right, nodeSize(left) + nodeSize(right)}
+	return newBranch(prefix, branchBit, left, right)
+}
+
+// Smart leaf constructor
+func mkLeaf[K, V any](key keyt, values []pair[K, V]) node[K, V] {
+	if len(values) == 0 {
+		return nil
+	}
+
+	return &leaf[K, V]{key: key, values: values}
 }
 
 // join merges two trees t0 and t1 which have prefixes p0 and p1 respectively.
 // The prefixes must not be equal!
-func join[K, V any](p0, p1 keyt, t0, t1 node[K, V]) node[K, V] {
+func join[K, V any](p0, p1 keyt, t0, t1 node[K, V]) *branch[K, V] {
 	bbit := branchingBit(p0, p1)
 	prefix := p0 & (bbit - 1)
-	sz := nodeSize(t0) + nodeSize(t1)
 	if zeroBit(p0, bbit) {
-		return &branch[K, V]{prefix, bbit, t0, t1, sz}
+		return newBranch(prefix, bbit, t0, t1)
 	} else {
-		return &branch[K, V]{prefix, bbit, t1, t0, sz}
+		return newBranch(prefix, bbit, t1, t0)
 	}
 }
 
@@ -302,9 +581,9 @@ func insert[K, V any](tree node[K, V], hash keyt, key K, value V, hasher Hasher[
 				}
 			}
 
-			// Hash collision - append to list of values in leaf
+			// Hash collision - add to list of values in leaf
 			lf := tree.copy()
-			lf.values = append(lf.values, pair[K, V]{key, value})
+			lf.values = slices.Insert(lf.values, bucketIndex(lf.values, key, hasher), pair[K, V]{key, value})
 			return lf, true
 		}
 
@@ -322,7 +601,7 @@ func insert[K, V any](tree node[K, V], hash keyt, key K, value V, hasher Hasher[
 			if !changed {
 				return tree, false
 			}
-			return &branch[K, V]{tree.prefix, tree.branchBit, l, r, nodeSize(l) + nodeSize(r)}, true
+			return newBranch(tree.prefix, tree.branchBit, l, r), true
 		}
 
 		prefix = tree.prefix
@@ -335,6 +614,78 @@ func insert[K, V any](tree node[K, V], hash keyt, key K, value V, hasher Hasher[
 	return join(hash, prefix, newLeaf, tree), true
 }
 
+// alter updates the mapping for key (with precomputed hash) according to f.
+// If the returned flag is false, the returned node is (reference-)equal to the input node.
+func alter[K, V any](tree node[K, V], hash keyt, key K, hasher Hasher[K], f func(V, bool) (V, bool, bool)) (node[K, V], bool) {
+	var prefix keyt
+	switch tree := tree.(type) {
+	case nil:
+		var zero V
+		value, keep, _ := f(zero, false)
+		if !keep {
+			return nil, false
+		}
+		return &leaf[K, V]{key: hash, values: []pair[K, V]{{key, value}}}, true
+
+	case *leaf[K, V]:
+		if tree.key == hash {
+			for i, pr := range tree.values {
+				if hasher.Equal(key, pr.key) {
+					value, keep, changed := f(pr.value, true)
+					if !keep {
+						return mkLeaf(tree.key, append(tree.values[:i:i], tree.values[i+1:]...)), true
+					} else if !changed {
+						return tree, false
+					}
+
+					lf := tree.copy()
+					lf.values[i].value = value
+					return lf, true
+				}
+			}
+
+			var zero V
+			value, keep, _ := f(zero, false)
+			if !keep {
+				return tree, false
+			}
+
+			// Hash collision - add to list of values in leaf
+			lf := tree.copy()
+			lf.values = slices.Insert(lf.values, bucketIndex(lf.values, key, hasher), pair[K, V]{key, value})
+			return lf, true
+		}
+
+		prefix = tree.key
+
+	case *branch[K, V]:
+		if tree.match(hash) {
+			l, r := tree.left, tree.right
+			var changed bool
+			if zeroBit(hash, tree.branchBit) {
+				l, changed = alter(l, hash, key, hasher, f)
+			} else {
+				r, changed = alter(r, hash, key, hasher, f)
+			}
+			if !changed {
+				return tree, false
+			}
+			return br(tree.prefix, tree.branchBit, l, r), true
+		}
+
+		prefix = tree.prefix
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	newLeaf, changed := alter(nil, hash, key, hasher, f)
+	if !changed {
+		return tree, false
+	}
+	return join(hash, prefix, newLeaf, tree), true
+}
+
 // remove returns a tree with the key-value pair matching the provided key if it exists.
 // If such a pair does not exist the input tree is returned.
 func remove[K, V any](tree node[K, V], hash keyt, key K, hasher Hasher[K]) node[K, V] {
@@ -352,9 +703,9 @@ func remove[K, V any](tree node[K, V], hash keyt, key K, hasher Hasher[K]) node[
 					}
 
 					return &leaf[K, V]{
-						tree.key,
+						key: tree.key,
 						// Remove the i'th entry
-						append(tree.values[:i:i], tree.values[i+1:]...),
+						values: append(tree.values[:i:i], tree.values[i+1:]...),
 					}
 				}
 			}
@@ -426,15 +777,7 @@ func merge[K, V any](a, b node[K, V], hasher Hasher[K], f MergeFunc[V]) (node[K,
 	if s.branchBit == t.branchBit && s.prefix == t.prefix {
 		l, leq := merge(s.left, t.left, hasher, f)
 		r, req := merge(s.right, t.right, hasher, f)
-		if leq && req {
-			return s, true
-		} else if (leq || l == s.left) && (req || r == s.right) {
-			return s, false
-		} else if (leq || l == t.left) && (req || r == t.right) {
-			return t, false
-		}
-
-		return &branch[K, V]{s.prefix, s.branchBit, l, r, nodeSize(l) + nodeSize(r)}, false
+		return mergeBranches(s, t, l, leq, r, req)
 	}
 
 	if s.branchBit > t.branchBit {
@@ -455,7 +798,7 @@ func merge[K, V any](a, b node[K, V], hasher Hasher[K], f MergeFunc[V]) (node[K,
 				return s, false
 			}
 		}
-		return &branch[K, V]{s.prefix, s.branchBit, l, r, nodeSize(l) + nodeSize(r)}, false
+		return newBranch(s.prefix, s.branchBit, l, r), false
 	} else {
 		// prefixes disagree
 		return join(s.prefix, t.prefix, s, t), false
@@ -466,6 +809,381 @@ func merge[K, V any](a, b node[K, V], hasher Hasher[K], f MergeFunc[V]) (node[K,
 	// up future merge/equal operations on the result, which is important.
 }
 
+// mergeBranches constructs the result of merging two branches with equal
+// prefixes and branching bits, given the results of merging their subtrees.
+// Existing branches are reused when possible.
+func mergeBranches[K, V any](s, t *branch[K, V], l node[K, V], leq bool, r node[K, V], req bool) (node[K, V], bool) {
+	if leq && req {
+		return s, true
+	} else if (leq || l == s.left) && (req || r == s.right) {
+		return s, false
+	} else if (leq || l == t.left) && (req || r == t.right) {
+		return t, false
+	}
+
+	return newBranch(s.prefix, s.branchBit, l, r), false
+}
+
+// share returns a node that is equal to a, where subtrees of a that are equal
+// to subtrees of b are replaced by those of b.
+func share[K, V any](a, b node[K, V], hasher Hasher[K], eq func(V, V) bool) node[K, V] {
+	if a == b || a == nil || b == nil {
+		return a
+	}
+
+	if lf, ok := a.(*leaf[K, V]); ok {
+		// Find the leaf in b with the same hash, if any
+		for {
+			switch n := b.(type) {
+			case *leaf[K, V]:
+				if equal[K, V](lf, n, hasher, eq) {
+					return n
+				}
+				return a
+			case *branch[K, V]:
+				if !n.match(lf.key) {
+					return a
+				} else if zeroBit(lf.key, n.branchBit) {
+					b = n.left
+				} else {
+					b = n.right
+				}
+			default:
+				panic("unreachable: unexpected node type")
+			}
+		}
+	}
+
+	s := a.(*branch[K, V])
+	switch t := b.(type) {
+	case *leaf[K, V]:
+		if !s.match(t.key) {
+			return s
+		} else if zeroBit(t.key, s.branchBit) {
+			if l := share(s.left, b, hasher, eq); l != s.left {
+				return newBranch(s.prefix, s.branchBit, l, s.right)
+			}
+		} else if r := share(s.right, b, hasher, eq); r != s.right {
+			return newBranch(s.prefix, s.branchBit, s.left, r)
+		}
+		return s
+
+	case *branch[K, V]:
+		if s.branchBit == t.branchBit && s.prefix == t.prefix {
+			l := share(s.left, t.left, hasher, eq)
+			r := share(s.right, t.right, hasher, eq)
+			if l == t.left && r == t.right {
+				return t
+			} else if l == s.left && r == s.right {
+				return s
+			}
+			return newBranch(s.prefix, s.branchBit, l, r)
+		} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+			// t contains s
+			if zeroBit(s.prefix, t.branchBit) {
+				return share(a, t.left, hasher, eq)
+			}
+			return share(a, t.right, hasher, eq)
+		} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+			// s contains t
+			if zeroBit(t.prefix, s.branchBit) {
+				if l := share(s.left, b, hasher, eq); l != s.left {
+					return newBranch(s.prefix, s.branchBit, l, s.right)
+				}
+			} else if r := share(s.right, b, hasher, eq); r != s.right {
+				return newBranch(s.prefix, s.branchBit, s.left, r)
+			}
+		}
+
+		// Either the prefixes disagree, or nothing in s was replaced
+		return s
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
+// intersect two nodes. Subtrees of the result are reused from a or b when
+// possible.
+func intersect[K, V any](a, b node[K, V], hasher Hasher[K], f MergeFunc[V]) node[K, V] {
+	if a == b {
+		return a
+	} else if a == nil || b == nil {
+		return nil
+	}
+
+	// Check if either a or b is a leaf
+	lf, isLeaf := a.(*leaf[K, V])
+	other := b
+	if !isLeaf {
+		lf, isLeaf = b.(*leaf[K, V])
+		other = a
+	}
+
+	if isLeaf {
+		var values []pair[K, V]
+		unchanged := true
+		for _, pr := range lf.values {
+			if ov, found := lookup(other, lf.key, pr.key, hasher); found {
+				v, eq := f(pr.value, ov)
+				unchanged = unchanged && eq
+				values = append(values, pair[K, V]{pr.key, v})
+			} else {
+				unchanged = false
+			}
+		}
+
+		if unchanged {
+			return lf
+		}
+		return mkLeaf(lf.key, values)
+	}
+
+	// Both a and b are branches
+	s, t := a.(*branch[K, V]), b.(*branch[K, V])
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		l := intersect(s.left, t.left, hasher, f)
+		r := intersect(s.right, t.right, hasher, f)
+		if l == s.left && r == s.right {
+			return s
+		} else if l == t.left && r == t.right {
+			return t
+		}
+
+		return br(s.prefix, s.branchBit, l, r)
+	}
+
+	if s.branchBit > t.branchBit {
+		s, t = t, s
+	}
+
+	if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		sub := s.right
+		if zeroBit(t.prefix, s.branchBit) {
+			sub = s.left
+		}
+		return intersect(sub, t, hasher, f)
+	}
+
+	// prefixes disagree
+	return nil
+}
+
+// intersectWith intersects two nodes with (possibly) different value types.
+func intersectWith[K, A, B, C any](a node[K, A], b node[K, B], hasher Hasher[K], f func(K, A, B) (C, bool)) node[K, C] {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	if lf, ok := a.(*leaf[K, A]); ok {
+		var values []pair[K, C]
+		for _, pr := range lf.values {
+			if bv, found := lookup(b, lf.key, pr.key, hasher); found {
+				if v, keep := f(pr.key, pr.value, bv); keep {
+					values = append(values, pair[K, C]{pr.key, v})
+				}
+			}
+		}
+		return mkLeaf(lf.key, values)
+	} else if lf, ok := b.(*leaf[K, B]); ok {
+		var values []pair[K, C]
+		for _, pr := range lf.values {
+			if av, found := lookup(a, lf.key, pr.key, hasher); found {
+				if v, keep := f(pr.key, av, pr.value); keep {
+					values = append(values, pair[K, C]{pr.key, v})
+				}
+			}
+		}
+		return mkLeaf(lf.key, values)
+	}
+
+	// Both a and b are branches
+	s, t := a.(*branch[K, A]), b.(*branch[K, B])
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		return br(s.prefix, s.branchBit,
+			intersectWith(s.left, t.left, hasher, f),
+			intersectWith(s.right, t.right, hasher, f))
+	} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		if zeroBit(t.prefix, s.branchBit) {
+			return intersectWith(s.left, t, hasher, f)
+		}
+		return intersectWith(s.right, t, hasher, f)
+	} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+		// t contains s
+		if zeroBit(s.prefix, t.branchBit) {
+			return intersectWith(s, t.left, hasher, f)
+		}
+		return intersectWith(s, t.right, hasher, f)
+	}
+
+	// prefixes disagree
+	return nil
+}
+
+// difference removes the keys of b from a. Subtrees of the result are reused
+// from a when possible.
+func difference[K, A, B any](a node[K, A], b node[K, B], hasher Hasher[K]) node[K, A] {
+	if a == nil || b == nil {
+		return a
+	} else if any(a) == any(b) {
+		// Shared subtree (only possible when A = B)
+		return nil
+	}
+
+	if lf, ok := a.(*leaf[K, A]); ok {
+		var values []pair[K, A]
+		for _, pr := range lf.values {
+			if _, found := lookup(b, lf.key, pr.key, hasher); !found {
+				values = append(values, pr)
+			}
+		}
+
+		if len(values) == len(lf.values) {
+			return lf
+		}
+		return mkLeaf(lf.key, values)
+	} else if lf, ok := b.(*leaf[K, B]); ok {
+		for _, pr := range lf.values {
+			a = remove(a, lf.key, pr.key, hasher)
+		}
+		return a
+	}
+
+	// Both a and b are branches
+	s, t := a.(*branch[K, A]), b.(*branch[K, B])
+	if s.branchBit == t.branchBit && s.prefix == t.prefix {
+		l := difference(s.left, t.left, hasher)
+		r := difference(s.right, t.right, hasher)
+		if l == s.left && r == s.right {
+			return s
+		}
+		return br(s.prefix, s.branchBit, l, r)
+	} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+		// s contains t
+		l, r := s.left, s.right
+		if zeroBit(t.prefix, s.branchBit) {
+			l = difference(l, t, hasher)
+		} else {
+			r = difference(r, t, hasher)
+		}
+
+		if l == s.left && r == s.right {
+			return s
+		}
+		return br(s.prefix, s.branchBit, l, r)
+	} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+		// t contains s
+		if zeroBit(s.prefix, t.branchBit) {
+			return difference(s, t.left, hasher)
+		}
+		return difference(s, t.right, hasher)
+	}
+
+	// prefixes disagree
+	return s
+}
+
+// isSubmap checks whether every key-value pair of a is included in b.
+func isSubmap[K, V any](a, b node[K, V], hasher Hasher[K], leq func(V, V) bool) bool {
+	if a == b || a == nil {
+		return true
+	} else if b == nil || nodeSize(a) > nodeSize(b) {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *leaf[K, V]:
+		for _, pr := range a.values {
+			if bv, found := lookup(b, a.key, pr.key, hasher); !found || !leq(pr.value, bv) {
+				return false
+			}
+		}
+		return true
+
+	case *branch[K, V]:
+		t, ok := b.(*branch[K, V])
+		if !ok {
+			// a contains at least two distinct hashes, b only one
+			return false
+		}
+
+		if a.branchBit == t.branchBit && a.prefix == t.prefix {
+			return isSubmap(a.left, t.left, hasher, leq) &&
+				isSubmap(a.right, t.right, hasher, leq)
+		} else if t.branchBit < a.branchBit && t.match(a.prefix) {
+			// t contains a
+			if zeroBit(a.prefix, t.branchBit) {
+				return isSubmap(a, t.left, hasher, leq)
+			}
+			return isSubmap(a, t.right, hasher, leq)
+		}
+
+		// a has keys on both sides of a branch that b does not have, or the
+		// prefixes disagree.
+		return false
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
+// partition splits a node into the pairs that satisfy pred and those that do not.
+func partition[K, V any](n node[K, V], pred func(K, V) bool) (in, out node[K, V]) {
+	switch n := n.(type) {
+	case nil:
+		return nil, nil
+	case *leaf[K, V]:
+		var inValues, outValues []pair[K, V]
+		for _, pr := range n.values {
+			if pred(pr.key, pr.value) {
+				inValues = append(inValues, pr)
+			} else {
+				outValues = append(outValues, pr)
+			}
+		}
+
+		if len(outValues) == 0 {
+			return n, nil
+		} else if len(inValues) == 0 {
+			return nil, n
+		}
+		return &leaf[K, V]{key: n.key, values: inValues}, &leaf[K, V]{key: n.key, values: outValues}
+
+	case *branch[K, V]:
+		lin, lout := partition(n.left, pred)
+		rin, rout := partition(n.right, pred)
+		if lin == n.left && rin == n.right {
+			return n, nil
+		} else if lout == n.left && rout == n.right {
+			return nil, n
+		}
+		return br(n.prefix, n.branchBit, lin, rin), br(n.prefix, n.branchBit, lout, rout)
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
+// mapValues copies a node while applying f to all values.
+func mapValues[K, V, W any](n node[K, V], f func(K, V) W) node[K, W] {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case *leaf[K, V]:
+		values := make([]pair[K, W], len(n.values))
+		for i, pr := range n.values {
+			values[i] = pair[K, W]{pr.key, f(pr.key, pr.value)}
+		}
+		return &leaf[K, W]{key: n.key, values: values}
+	case *branch[K, V]:
+		return newBranch(n.prefix, n.branchBit, mapValues(n.left, f), mapValues(n.right, f))
+	default:
+		panic("unreachable: unexpected node type")
+	}
+}
+
 func equal[K, V any](a, b node[K, V], hasher Hasher[K], f func(V, V) bool) bool {
 	if a == b {
 		return true
@@ -511,3 +1229,99 @@ func equal[K, V any](a, b node[K, V], hasher Hasher[K], f func(V, V) bool) bool
 		panic("unreachable: unexpected node type")
 	}
 }
+
+// hashOwner identifies the value hashing that a cached content hash was
+// computed with. The type has non-zero size such that distinct owners have
+// distinct addresses.
+type hashOwner struct{ _ byte }
+
+// hashCache is a content hash cached in a node.
+type hashCache struct {
+	owner *hashOwner
+	hash  uint64
+}
+
+// cachedHash returns the content hash of n that was cached by owner, if any.
+func cachedHash[K, V any](n node[K, V], owner *hashOwner) (uint64, bool) {
+	var c *hashCache
+	switch n := n.(type) {
+	case *leaf[K, V]:
+		c = n.chash.Load()
+	case *branch[K, V]:
+		c = n.chash.Load()
+	}
+
+	if c == nil || owner == nil || c.owner != owner {
+		return 0, false
+	}
+	return c.hash, true
+}
+
+// mix64 is the finalizer of SplitMix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// contentHash returns a hash of the contents of the subtree rooted at n that
+// does not depend on the order of colliding keys in leaves. If owner is not
+// nil, the hash is cached in the nodes on behalf of owner, so subtrees are
+// only hashed once by each owner.
+//
+// The trie structure is determined by the contents, so branches combine the
+// hashes of their subtrees in order. Within a leaf the key-value pairs are
+// combined with addition, which is commutative.
+func contentHash[K, V any](n node[K, V], valueHash func(V) uint64, owner *hashOwner) uint64 {
+	if n == nil {
+		return 0
+	} else if h, ok := cachedHash(n, owner); ok {
+		return h
+	}
+
+	var h uint64
+	switch n := n.(type) {
+	case *leaf[K, V]:
+		for _, pr := range n.values {
+			h += mix64(n.key ^ bits.RotateLeft64(valueHash(pr.value), 32))
+		}
+		h = mix64(h + uint64(len(n.values)))
+		if owner != nil {
+			n.chash.Store(&hashCache{owner, h})
+		}
+	case *branch[K, V]:
+		l, r := contentHash(n.left, valueHash, owner), contentHash(n.right, valueHash, owner)
+		h = mix64(l ^ bits.RotateLeft64(mix64(r), 17))
+		if owner != nil {
+			n.chash.Store(&hashCache{owner, h})
+		}
+	default:
+		panic("unreachable: unexpected node type")
+	}
+	return h
+}
+
+// hashedEqual is like equal, but rejects pairs of subtrees whose content
+// hashes, as cached by owner, differ. The hashes must be consistent with f.
+func hashedEqual[K, V any](a, b node[K, V], hasher Hasher[K], f func(V, V) bool, owner *hashOwner) bool {
+	if a == b {
+		return true
+	} else if a == nil || b == nil {
+		return false
+	} else if ha, ok := cachedHash(a, owner); ok {
+		if hb, ok := cachedHash(b, owner); ok && ha != hb {
+			return false
+		}
+	}
+
+	s, sok := a.(*branch[K, V])
+	t, tok := b.(*branch[K, V])
+	if !sok || !tok {
+		return equal(a, b, hasher, f)
+	}
+
+	return s.prefix == t.prefix && s.branchBit == t.branchBit && s.size == t.size &&
+		hashedEqual(s.left, t.left, hasher, f, owner) && hashedEqual(s.right, t.right, hasher, f, owner)
+}
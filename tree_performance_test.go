@@ -35,6 +35,7 @@ var mutableMapImpls = []struct {
 }{
 	{"map", func() MutableMap[int, int] { return make(MapMap[int, int]) }},
 	{"tree", func() MutableMap[int, int] { return &MutableTree[int, int]{New[int](intHasher)} }},
+	{"builder", func() MutableMap[int, int] { return NewBuilder[int](intHasher) }},
 }
 
 func BenchmarkInserts(b *testing.B) {
@@ -3,6 +3,7 @@ package pmmap
 import (
 	"fmt"
 	"math/rand"
+	"slices"
 	"testing"
 )
 
@@ -277,6 +278,517 @@ func TestManyMerge(t *testing.T) {
 	}
 }
 
+func TestMergeAll(t *testing.T) {
+	hit, _ := mkTest[int, int](t)
+	N := 100
+
+	for range 20 {
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			base := New[int](hasher)
+			for i := range N {
+				base = base.Insert(i, 0)
+			}
+
+			expect := base
+			trees := []Tree[int, int]{New[int](hasher)}
+			for range 1 + rand.Intn(20) {
+				tree := base
+				for range 5 {
+					k, v := rand.Intn(2*N), rand.Int()
+					tree = tree.InsertOrMerge(k, v, max)
+					expect = expect.InsertOrMerge(k, v, max)
+				}
+				// Include duplicates of each map
+				for range 1 + rand.Intn(3) {
+					trees = append(trees, tree)
+				}
+			}
+			rand.Shuffle(len(trees), func(i, j int) {
+				trees[i], trees[j] = trees[j], trees[i]
+			})
+
+			res := MergeAll(max, trees...)
+			if !res.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", expect)
+			}
+			for k, v := range expect.All() {
+				hit(res, k, v)
+			}
+		}
+	}
+
+	t.Run("Duplicates", func(t *testing.T) {
+		tree := New[int](intHasher).Insert(1, 1)
+		if res := MergeAll(max, tree, tree, tree); res.root != tree.root {
+			t.Errorf("Expected %p to be %p", res.root, tree.root)
+		}
+		if res := MergeAll(max, New[int](intHasher)); res.root != nil {
+			t.Errorf("Expected empty map, got %v", res)
+		}
+	})
+
+	t.Run("NoMaps", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected MergeAll to panic")
+			}
+		}()
+		MergeAll[int](max)
+	})
+}
+
+func TestIntersect(t *testing.T) {
+	hit, miss := mkTest[int, int](t)
+	N := 100
+
+	for range 50 {
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			a, b := New[int](hasher), New[int](hasher)
+			inA, inB := make(map[int]int), make(map[int]int)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					inA[i] = rand.Int()
+					a = a.Insert(i, inA[i])
+				}
+				if rand.Intn(2) == 0 {
+					inB[i] = rand.Int()
+					b = b.Insert(i, inB[i])
+				}
+			}
+
+			res := a.Intersect(b, max)
+			hetero := Intersect(a, New[string](hasher), func(int, int, string) (bool, bool) {
+				return true, true
+			})
+			if hetero.Size() != 0 {
+				t.Fatalf("Intersect with empty tree yielded %v", hetero)
+			}
+			sums := Intersect(a, b, func(k, x, y int) (string, bool) {
+				return fmt.Sprint(x + y), k%2 == 0
+			})
+
+			expectSize := 0
+			for i := range 2 * N {
+				va, okA := inA[i]
+				vb, okB := inB[i]
+				if okA && okB {
+					expectSize++
+					mx, _ := max(va, vb)
+					hit(res, i, mx)
+					if v, found := sums.Lookup(i); found != (i%2 == 0) || found && v != fmt.Sprint(va+vb) {
+						t.Fatalf("Intersect(%d) = %q, %v", i, v, found)
+					}
+				} else {
+					miss(res, i)
+					if _, found := sums.Lookup(i); found {
+						t.Fatalf("Unexpected key %d in heterogeneous intersection", i)
+					}
+				}
+			}
+
+			if sz := res.Size(); sz != expectSize {
+				t.Fatalf("Expected size %d, got %d", expectSize, sz)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+		b := a.Insert(N, N).Insert(N+1, N+1)
+
+		if res := a.Intersect(b, max); res.root != a.root {
+			t.Errorf("Expected %p to be %p", res.root, a.root)
+		}
+		if res := b.Intersect(a, max); res.root != a.root {
+			t.Errorf("Expected %p to be %p", res.root, a.root)
+		}
+	})
+}
+
+func TestDifference(t *testing.T) {
+	hit, miss := mkTest[int, int](t)
+	N := 100
+
+	for range 50 {
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			a, b := New[int](hasher), New[int](hasher)
+			keys := NewSet(hasher)
+			inB := make(map[int]bool)
+			for i := range 2 * N {
+				a = a.Insert(i, i)
+				if rand.Intn(2) == 0 {
+					b = b.Insert(i, -i)
+					keys = keys.Insert(i)
+					inB[i] = true
+				}
+			}
+
+			for _, res := range []Tree[int, int]{a.Difference(b), a.Without(keys)} {
+				for i := range 2 * N {
+					if inB[i] {
+						miss(res, i)
+					} else {
+						hit(res, i, i)
+					}
+				}
+				if sz := res.Size(); sz != 2*N-len(inB) {
+					t.Fatalf("Expected size %d, got %d", 2*N-len(inB), sz)
+				}
+			}
+
+			// Keys of a map with another value type
+			labels := New[string](hasher)
+			for k := range keys.All() {
+				labels = labels.Insert(k, fmt.Sprint(k))
+			}
+			if res := Difference(a, labels); !res.Equal(a.Difference(b), cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", a.Difference(b))
+			}
+
+			// Shares most of its structure with a
+			c := a.Remove(0).Insert(-1, -1)
+			res := a.Difference(c)
+			hit(res, 0, 0)
+			if sz := res.Size(); sz != 1 {
+				t.Fatalf("Expected size 1, got %d", sz)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+
+		if res := a.Difference(a); res.root != nil {
+			t.Errorf("Expected empty tree, got %v", res)
+		}
+		if res := a.Difference(New[int](intHasher).Insert(2*N, 0)); res.root != a.root {
+			t.Errorf("Expected %p to be %p", res.root, a.root)
+		}
+	})
+}
+
+func TestIsSubmapOf(t *testing.T) {
+	N := 100
+	leq := func(a, b int) bool { return a <= b }
+
+	for range 50 {
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			a, b := New[int](hasher), New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(3) != 0 {
+					b = b.Insert(i, i)
+					if rand.Intn(2) == 0 {
+						a = a.Insert(i, i-rand.Intn(2))
+					}
+				}
+			}
+
+			if !a.IsSubmapOf(b, leq) {
+				t.Fatalf("Expected %v to be a submap of %v", a, b)
+			}
+			if !a.IsSubmapOf(a.Merge(b, max), leq) {
+				t.Fatalf("Expected %v to be a submap of its merge with %v", a, b)
+			}
+			if b.Size() > a.Size() && b.IsSubmapOf(a, leq) {
+				t.Fatalf("Expected %v not to be a submap of %v", b, a)
+			}
+
+			var k int
+			for k = range a.Keys() {
+				break
+			}
+			if a.Size() > 0 && a.IsSubmapOf(b.Insert(k, k-2), leq) {
+				t.Fatalf("Expected value of %d to fail the predicate", k)
+			}
+			if a.Size() > 0 && a.IsSubmapOf(b.Remove(k), leq) {
+				t.Fatalf("Expected %v not to be a submap when %d is missing", a, k)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+
+		calls := 0
+		if !a.IsSubmapOf(a.Insert(N, N), func(x, y int) bool {
+			calls++
+			return x == y
+		}) {
+			t.Error("Expected a to be a submap of a version of itself")
+		}
+		if calls != 0 {
+			t.Errorf("Expected shared subtrees to be skipped, leq was called %d times", calls)
+		}
+	})
+}
+
+func TestPartition(t *testing.T) {
+	hit, miss := mkTest[int, int](t)
+	N := 100
+
+	for range 50 {
+		for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+			tree := New[int](hasher)
+			keep := make(map[int]bool)
+			for i := range 2 * N {
+				tree = tree.Insert(i, i)
+				keep[i] = rand.Intn(2) == 0
+			}
+
+			pred := func(k, _ int) bool { return keep[k] }
+			in, out := tree.Partition(pred)
+			filtered := tree.Filter(pred)
+			if !filtered.Equal(in, cmpEq[int]) {
+				t.Fatalf("Expected %v to equal %v", filtered, in)
+			}
+
+			for i := range 2 * N {
+				if keep[i] {
+					hit(in, i, i)
+					miss(out, i)
+				} else {
+					miss(in, i)
+					hit(out, i, i)
+				}
+			}
+
+			if in.Size()+out.Size() != tree.Size() {
+				t.Fatalf("Partition sizes %d + %d do not add up to %d", in.Size(), out.Size(), tree.Size())
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		tree := New[int](intHasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		if res := tree.Filter(func(int, int) bool { return true }); res.root != tree.root {
+			t.Errorf("Expected %p to be %p", res.root, tree.root)
+		}
+
+		// Hashes are bit-reversed, so the root branches on the most significant bit
+		in, out := tree.Partition(func(k, _ int) bool { return k < 64 })
+		if in.root != tree.root.(*branch[int, int]).left {
+			t.Error("Expected left subtree to be reused")
+		}
+		if out.root != tree.root.(*branch[int, int]).right {
+			t.Error("Expected right subtree to be reused")
+		}
+	})
+}
+
+func TestMapValues(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, mkMemHasher(N / 5)} {
+		tree := New[int](hasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		hit, miss := mkTest[int, string](t)
+		mapped := MapValues(tree, func(k, v int) string { return fmt.Sprint(k + v) })
+		for i := range N {
+			hit(mapped, i, fmt.Sprint(2*i))
+		}
+		miss(mapped, N)
+
+		if sz := mapped.Size(); sz != N {
+			t.Fatalf("Expected size %d, got %d", N, sz)
+		}
+
+		keys := tree.KeySet()
+		if sz := keys.Size(); sz != N {
+			t.Fatalf("Expected size %d, got %d", N, sz)
+		}
+		for i := range N {
+			if !keys.Contains(i) {
+				t.Fatalf("Expected key set to contain %d", i)
+			}
+		}
+	}
+}
+
+func TestAlter(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		hit, miss := mkTest[int, int](t)
+		tree := New[int](hasher)
+		for i := range N {
+			tree = tree.Insert(i, i)
+		}
+
+		increment := func(old int, found bool) (int, bool) { return old + 1, true }
+		remove := func(int, bool) (int, bool) { return 0, false }
+		keep := func(old int, found bool) (int, bool) { return old, found }
+
+		res, changed := tree.Alter(N, increment)
+		if !changed {
+			t.Error("Expected insertion to change the map")
+		}
+		hit(res, N, 1)
+
+		res, changed = tree.Alter(0, increment)
+		if !changed {
+			t.Error("Expected update to change the map")
+		}
+		hit(res, 0, 1)
+
+		res, changed = tree.Alter(1, remove)
+		if !changed {
+			t.Error("Expected removal to change the map")
+		}
+		miss(res, 1)
+		if sz := res.Size(); sz != N-1 {
+			t.Errorf("Expected size %d, got %d", N-1, sz)
+		}
+
+		for _, tc := range []struct {
+			key int
+			f   func(int, bool) (int, bool)
+		}{{N, remove}, {N, keep}} {
+			res, changed = tree.Alter(tc.key, tc.f)
+			if changed || res.root != tree.root {
+				t.Errorf("Expected Alter(%d) to leave the map unchanged", tc.key)
+			}
+		}
+
+		// Alter cannot compare values, so rewriting a value is a change
+		if res, changed = tree.Alter(0, keep); !changed || res.root == tree.root {
+			t.Error("Expected rewriting a value with Alter to change the map")
+		}
+		hit(res, 0, 0)
+
+		unchanged := func(old int, found bool) (int, bool, bool) { return old, found, false }
+		for _, k := range []int{0, N} {
+			res, changed = tree.AlterFunc(k, unchanged)
+			if changed || res.root != tree.root {
+				t.Errorf("Expected AlterFunc(%d) to leave the map unchanged", k)
+			}
+		}
+
+		res, changed = tree.AlterFunc(0, func(old int, found bool) (int, bool, bool) { return old + 1, true, true })
+		if !changed {
+			t.Error("Expected update to change the map")
+		}
+		hit(res, 0, 1)
+	}
+}
+
+type collidingHasher struct{ NumericHasher[int] }
+
+func (collidingHasher) Hash(x int) uint64 { return uint64(x % 3) }
+
+func TestCanonicalOrder(t *testing.T) {
+	N := 30
+	hasher := collidingHasher{}
+
+	keys := make([]int, N)
+	for i := range keys {
+		keys[i] = i
+	}
+
+	var expect string
+	for range 20 {
+		rand.Shuffle(N, func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+
+		// Build the same map in several different ways
+		a, b := New[int](hasher), New[int](hasher)
+		builder := NewBuilder[int](hasher)
+		for i, k := range keys {
+			if i%2 == 0 {
+				a = a.Insert(k, k)
+			} else {
+				b = b.Insert(k, k)
+			}
+			builder.Insert(k, k)
+		}
+
+		for _, tree := range []Tree[int, int]{
+			a.Merge(b, max),
+			b.Merge(a, max),
+			builder.Freeze(),
+			Collect(hasher, func(yield func(int, int) bool) {
+				for _, k := range slices.Backward(keys) {
+					if !yield(k, k) {
+						return
+					}
+				}
+			}, nil),
+		} {
+			if expect == "" {
+				expect = tree.String()
+			} else if str := tree.String(); str != expect {
+				t.Fatalf("Expected %s to equal %s", str, expect)
+			}
+		}
+	}
+}
+
+func TestPositional(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		tree := New[int](hasher)
+		for i := range N {
+			tree = tree.Insert(i, -i)
+		}
+
+		i := 0
+		for k, v := range tree.All() {
+			if ak, av := tree.At(i); ak != k || av != v {
+				t.Fatalf("At(%d) = %d, %d, expected %d, %d", i, ak, av, k, v)
+			}
+			if r := tree.Rank(k); r != i {
+				t.Fatalf("Rank(%d) = %d, expected %d", k, r, i)
+			}
+			i++
+		}
+
+		if r := tree.Rank(N); r != -1 {
+			t.Fatalf("Rank(%d) = %d, expected -1", N, r)
+		}
+
+		rng := rand.New(rand.NewSource(0))
+		counts := make([]int, N)
+		for range 100 * N {
+			k, v := tree.Sample(rng)
+			if v != -k {
+				t.Fatalf("Sample() = %d, %d", k, v)
+			}
+			counts[k]++
+		}
+		for k, c := range counts {
+			if c < 50 || c > 150 {
+				t.Errorf("Key %d was sampled %d times, expected around 100", k, c)
+			}
+		}
+	}
+
+	t.Run("OutOfRange", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected At to panic")
+			}
+		}()
+		New[int](intHasher).Insert(0, 0).At(1)
+	})
+}
+
 func TestRemove(t *testing.T) {
 	hit, miss := mkTest[uint32, uint32](t)
 	iterations := 100
@@ -427,6 +939,129 @@ func TestIter(t *testing.T) {
 	})
 }
 
+type parityHasher struct{}
+
+func (parityHasher) Equal(a, b int) bool { return a%2 == b%2 }
+func (parityHasher) Hash(a int) uint64   { return uint64(a % 2) }
+
+func TestTreeHasher(t *testing.T) {
+	N := 100
+
+	for _, h := range []TreeHasher[int, int]{NewTreeHasher[int](intHasher), {Values: intHasher}} {
+		for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+			for range 20 {
+				keys := rand.Perm(2 * N)[:N]
+				a, b := New[int](hasher), New[int](hasher)
+				for _, k := range keys {
+					a = a.Insert(k, k%3)
+				}
+				// Insert in a different order to obtain different leaf buckets
+				for i := len(keys) - 1; i >= 0; i-- {
+					b = b.Insert(keys[i], keys[i]%3)
+				}
+
+				if ha, hb := h.Hash(a), h.Hash(b); ha != hb || !h.Equal(a, b) {
+					t.Fatalf("Expected equal maps with equal hashes, got %x and %x", ha, hb)
+				}
+
+				c := a.Insert(keys[0], -1)
+				if h.Hash(c) == h.Hash(a) || h.Equal(c, a) {
+					t.Fatal("Expected", c, "to differ from", a)
+				}
+				// Cached hashes do not affect Equal with other value equalities
+				if !c.Equal(a, func(int, int) bool { return true }) {
+					t.Fatal("Expected", c, "to equal", a, "when all values are equal")
+				}
+			}
+		}
+	}
+
+	t.Run("ValueHashers", func(t *testing.T) {
+		a := New[int](intHasher).Insert(1, 1).Insert(2, 2)
+		b := New[int](intHasher).Insert(1, 3).Insert(2, 4)
+		exact, parity := NewTreeHasher[int](intHasher), NewTreeHasher[int, int](parityHasher{})
+
+		if exact.Hash(a) == exact.Hash(b) || exact.Equal(a, b) {
+			t.Fatal("Expected", a, "to differ from", b)
+		}
+		if !a.Equal(b, parityHasher{}.Equal) {
+			t.Fatal("Expected", a, "to equal", b, "by parity")
+		}
+		// The hashes cached by exact are not used by parity
+		if parity.Hash(a) != parity.Hash(b) || !parity.Equal(a, b) {
+			t.Fatal("Expected", a, "to equal", b, "by parity")
+		}
+		if exact.Equal(a, b) {
+			t.Fatal("Expected", a, "to differ from", b)
+		}
+	})
+
+	t.Run("Nested", func(t *testing.T) {
+		empty := New[int](intHasher)
+		outer := New[string](Hasher[Tree[int, int]](NewTreeHasher[int](intHasher)))
+		for i := range 10 {
+			inner := empty
+			for j := range i {
+				inner = inner.Insert(j, j)
+			}
+			outer = outer.Insert(inner, fmt.Sprint(i))
+		}
+
+		hit, _ := mkTest[Tree[int, int], string](t)
+		hit(outer, empty, "0")
+		hit(outer, empty.Insert(1, 1).Insert(0, 0), "2")
+	})
+}
+
+func TestShareWith(t *testing.T) {
+	N := 100
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		for range 20 {
+			a, b := New[int](hasher), New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					a = a.Insert(i, i%3)
+				}
+				if rand.Intn(2) == 0 {
+					b = b.Insert(i, rand.Intn(3))
+				}
+			}
+
+			if res := a.ShareWith(b, cmpEq[int]); !res.Equal(a, cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", a)
+			}
+
+			// Rebuild a independently in a different order
+			c := New[int](hasher)
+			for _, k := range slices.Backward(slices.Collect(a.Keys())) {
+				c = c.Insert(k, k%3)
+			}
+			if res := c.ShareWith(a, cmpEq[int]); res.root != a.root {
+				t.Fatalf("Expected %p to be %p", res.root, a.root)
+			}
+		}
+	}
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a, b := New[int](intHasher), New[int](intHasher)
+		for i := range N {
+			a, b = a.Insert(i, i), b.Insert(i, i)
+		}
+		b = b.Insert(N, N)
+
+		// The root splits the keys below 64 from the rest
+		res := a.ShareWith(b, cmpEq[int])
+		rr, br := res.root.(*branch[int, int]), b.root.(*branch[int, int])
+		if rr.left != br.left {
+			t.Errorf("Expected %p to be %p", rr.left, br.left)
+		}
+		if !res.Equal(a, cmpEq[int]) {
+			t.Error("Expected", res, "to equal", a)
+		}
+	})
+}
+
 func TestPointerHasher(t *testing.T) {
 	h := PointerHasher[int]{}
 
@@ -0,0 +1,191 @@
+package pmmap
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ConflictError is returned by [Tree.TryMerge] when the values for a key could
+// not be merged.
+type ConflictError[K, V any] struct {
+	Key         K
+	Left, Right V
+	// The error returned by the merge function
+	Err error
+}
+
+func (e *ConflictError[K, V]) Error() string {
+	return fmt.Sprintf("pmmap: conflicting values for key %v: %v", e.Key, e.Err)
+}
+
+func (e *ConflictError[K, V]) Unwrap() error {
+	return e.Err
+}
+
+// TryMerge is like Merge, but the values for keys in both maps are merged with
+// a function that may fail. `f` receives the key, the value from this map and
+// the value from the other map. Like for MergeFunc, the returned flag should be
+// true iff. the two values are equal, and `f` must be idempotent.
+//
+// If `f` returns an error, the merge stops and TryMerge returns this map
+// unchanged, along with a *ConflictError that wraps the error.
+func (tree Tree[K, V]) TryMerge(other Tree[K, V], f func(k K, a, b V) (V, bool, error)) (Tree[K, V], error) {
+	root, _, err := tryMerge(tree.root, other.root, tree.hasher, f)
+	if err != nil {
+		return tree, err
+	}
+	tree.root = root
+	return tree, nil
+}
+
+// tryMerge mirrors merge, but preserves the order of arguments to f.
+func tryMerge[K, V any](a, b node[K, V], hasher Hasher[K], f func(K, V, V) (V, bool, error)) (node[K, V], bool, error) {
+	if a == b {
+		return a, true, nil
+	} else if a == nil {
+		return b, false, nil
+	} else if b == nil {
+		return a, false, nil
+	}
+
+	switch s := a.(type) {
+	case *leaf[K, V]:
+		switch t := b.(type) {
+		case *leaf[K, V]:
+			if s.key == t.key {
+				return tryMergeLeaves(s, t, hasher, f)
+			}
+
+		case *branch[K, V]:
+			if t.match(s.key) {
+				// t contains s
+				l, r := t.left, t.right
+				var err error
+				if zeroBit(s.key, t.branchBit) {
+					l, _, err = tryMerge(a, l, hasher, f)
+				} else {
+					r, _, err = tryMerge(a, r, hasher, f)
+				}
+				if err != nil {
+					return nil, false, err
+				}
+				return rebuild(t, l, r), false, nil
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+
+	case *branch[K, V]:
+		switch t := b.(type) {
+		case *leaf[K, V]:
+			if s.match(t.key) {
+				// s contains t
+				l, r := s.left, s.right
+				var err error
+				if zeroBit(t.key, s.branchBit) {
+					l, _, err = tryMerge(l, b, hasher, f)
+				} else {
+					r, _, err = tryMerge(r, b, hasher, f)
+				}
+				if err != nil {
+					return nil, false, err
+				}
+				return rebuild(s, l, r), false, nil
+			}
+
+		case *branch[K, V]:
+			if s.branchBit == t.branchBit && s.prefix == t.prefix {
+				l, leq, err := tryMerge(s.left, t.left, hasher, f)
+				if err != nil {
+					return nil, false, err
+				}
+				r, req, err := tryMerge(s.right, t.right, hasher, f)
+				if err != nil {
+					return nil, false, err
+				}
+				res, eq := mergeBranches(s, t, l, leq, r, req)
+				return res, eq, nil
+			} else if s.branchBit < t.branchBit && s.match(t.prefix) {
+				// s contains t
+				l, r := s.left, s.right
+				var err error
+				if zeroBit(t.prefix, s.branchBit) {
+					l, _, err = tryMerge(l, b, hasher, f)
+				} else {
+					r, _, err = tryMerge(r, b, hasher, f)
+				}
+				if err != nil {
+					return nil, false, err
+				}
+				return rebuild(s, l, r), false, nil
+			} else if t.branchBit < s.branchBit && t.match(s.prefix) {
+				// t contains s
+				l, r := t.left, t.right
+				var err error
+				if zeroBit(s.prefix, t.branchBit) {
+					l, _, err = tryMerge(a, l, hasher, f)
+				} else {
+					r, _, err = tryMerge(a, r, hasher, f)
+				}
+				if err != nil {
+					return nil, false, err
+				}
+				return rebuild(t, l, r), false, nil
+			}
+
+		default:
+			panic("unreachable: unexpected node type")
+		}
+
+	default:
+		panic("unreachable: unexpected node type")
+	}
+
+	// prefixes disagree
+	return join(prefixOf(a), prefixOf(b), a, b), false, nil
+}
+
+// tryMergeLeaves merges two leaves with the same hash.
+func tryMergeLeaves[K, V any](s, t *leaf[K, V], hasher Hasher[K], f func(K, V, V) (V, bool, error)) (node[K, V], bool, error) {
+	values := slices.Clone(s.values)
+	matched, unchanged := 0, true
+	for i, pr := range s.values {
+		for _, tpr := range t.values {
+			if hasher.Equal(pr.key, tpr.key) {
+				v, eq, err := f(pr.key, pr.value, tpr.value)
+				if err != nil {
+					return nil, false, &ConflictError[K, V]{pr.key, pr.value, tpr.value, err}
+				}
+				values[i].value = v
+				matched++
+				unchanged = unchanged && eq
+				break
+			}
+		}
+	}
+
+	if matched == len(t.values) {
+		if unchanged {
+			return s, matched == len(s.values), nil
+		}
+		return mkLeaf(s.key, values), false, nil
+	}
+
+FOUND:
+	for _, tpr := range t.values {
+		for _, pr := range s.values {
+			if hasher.Equal(pr.key, tpr.key) {
+				continue FOUND
+			}
+		}
+
+		values = slices.Insert(values, bucketIndex(values, tpr.key, hasher), tpr)
+	}
+
+	if unchanged && matched == len(s.values) {
+		// Every key of s was in t with an equal value
+		return t, false, nil
+	}
+	return mkLeaf(s.key, values), false, nil
+}
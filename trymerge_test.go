@@ -0,0 +1,92 @@
+package pmmap
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestTryMerge(t *testing.T) {
+	N := 100
+	errConflict := errors.New("conflict")
+	// Merges equal values, and fails on different values
+	f := func(k, a, b int) (int, bool, error) {
+		if a != b {
+			return 0, false, errConflict
+		}
+		return a, true, nil
+	}
+
+	for _, hasher := range []Hasher[int]{intHasher, Hasher[int](badHasher[int]{}), mkMemHasher(N / 5)} {
+		for range 20 {
+			a, b := New[int](hasher), New[int](hasher)
+			for i := range 2 * N {
+				if rand.Intn(2) == 0 {
+					a = a.Insert(i, i)
+				}
+				if rand.Intn(2) == 0 {
+					b = b.Insert(i, i)
+				}
+			}
+
+			res, err := a.TryMerge(b, f)
+			if err != nil {
+				t.Fatal("Unexpected error:", err)
+			} else if expect := a.Merge(b, max); !res.Equal(expect, cmpEq[int]) {
+				t.Fatal("Expected", res, "to equal", expect)
+			}
+
+			k := rand.Intn(2 * N)
+			c := b.Insert(k, -1)
+			if _, found := a.Lookup(k); !found {
+				a = a.Insert(k, k)
+			}
+
+			res, err = a.TryMerge(c, f)
+			var conflict *ConflictError[int, int]
+			if !errors.As(err, &conflict) {
+				t.Fatalf("Expected a conflict, got %v", err)
+			} else if conflict.Key != k || conflict.Left != k || conflict.Right != -1 {
+				t.Fatalf("Expected conflict for %d ↦ %d, -1, got %v ↦ %v, %v", k, k, conflict.Key, conflict.Left, conflict.Right)
+			} else if !errors.Is(err, errConflict) {
+				t.Fatalf("Expected %v to wrap %v", err, errConflict)
+			} else if res.root != a.root {
+				t.Fatal("Expected", a, "to be returned unchanged, got", res)
+			} else if res = res.Insert(-1, -1); res.Size() != a.Size()+1 {
+				t.Fatal("Expected the returned map to remain usable, got", res)
+			}
+		}
+	}
+
+	t.Run("ArgumentOrder", func(t *testing.T) {
+		a, b := New[int](intHasher), New[int](intHasher)
+		for i := range N {
+			a, b = a.Insert(i, 0), b.Insert(i*7%(2*N), 1)
+		}
+
+		_, err := a.TryMerge(b, func(k, x, y int) (int, bool, error) {
+			if x != 0 || y != 1 {
+				return 0, false, errConflict
+			}
+			return x, false, nil
+		})
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	})
+
+	t.Run("SharedSubtrees", func(t *testing.T) {
+		a := New[int](intHasher)
+		for i := range N {
+			a = a.Insert(i, i)
+		}
+		b := a.Insert(N, N)
+
+		res, err := a.TryMerge(b, f)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		} else if res.root != b.root {
+			t.Errorf("Expected %p to be %p", res.root, b.root)
+		}
+	})
+}